@@ -0,0 +1,144 @@
+package gop2pt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	protocolName = "gop2pt"
+	// ProtocolVersion is the version of the gop2pt protocol spoken on data channels.
+	ProtocolVersion = 1
+	// The oldest protocol version we can still talk to.
+	minProtocolVersion = 1
+)
+
+// FeatureFraming is advertised in the capability handshake with WithMessageFraming. Along with
+// FeatureCompression and FeatureStreams, it is one of the features gop2pt implements itself.
+// Applications may advertise and require their own, which gop2pt passes along without acting on
+// them.
+const FeatureFraming = "framing"
+
+var ErrIncompatiblePeer = errors.New("incompatible peer")
+
+// Capabilities configures the capability handshake.
+type Capabilities struct {
+	// Features we support, in addition to those implied by other options.
+	Features []string
+	// Features the remote must support, otherwise it is dropped.
+	Required []string
+	// Sent to the remote as is, for example a user name or application version.
+	Metadata map[string]string
+}
+
+// PeerCapabilities is the outcome of the capability handshake with a peer.
+type PeerCapabilities struct {
+	// The protocol version both sides speak.
+	Version int
+	// Features supported by both sides, sorted.
+	Features []string
+	// The remote's metadata.
+	Metadata map[string]string
+}
+
+// Has reports whether both sides support feature.
+func (pc *PeerCapabilities) Has(feature string) bool {
+	i := sort.SearchStrings(pc.Features, feature)
+	return i < len(pc.Features) && pc.Features[i] == feature
+}
+
+// WithCapabilities exchanges protocol version, supported features and metadata with every peer
+// right after the data channel opens, and drops peers that are incompatible or lack a required
+// feature. The result is available from Conn.Capabilities. All peers must enable it.
+func WithCapabilities(capabilities Capabilities) Option {
+	return func(p *P2PT) {
+		p.capabilities = &capabilities
+	}
+}
+
+type capabilitiesMessage struct {
+	Protocol   string            `json:"protocol"`
+	Version    int               `json:"version"`
+	MinVersion int               `json:"min_version"`
+	Features   []string          `json:"features"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+func (p *P2PT) localFeatures() []string {
+	features := append([]string(nil), p.capabilities.Features...)
+	if p.messageFraming {
+		features = append(features, FeatureFraming)
+	}
+	if p.compression {
+		features = append(features, FeatureCompression)
+	}
+	if p.streams {
+		features = append(features, FeatureStreams)
+	}
+	return features
+}
+
+func (p *P2PT) capabilitiesHandshake(conn *webrtcNetConn) error {
+	local := p.localFeatures()
+	err := writeHandshakeMessage(conn, capabilitiesMessage{
+		Protocol:   protocolName,
+		Version:    ProtocolVersion,
+		MinVersion: minProtocolVersion,
+		Features:   local,
+		Metadata:   p.capabilities.Metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("sending capabilities: %w", err)
+	}
+
+	var remote capabilitiesMessage
+	if err := readHandshakeMessage(conn, &remote); err != nil {
+		return err
+	}
+	if remote.Protocol != protocolName {
+		return fmt.Errorf("%w: protocol %q", ErrIncompatiblePeer, remote.Protocol)
+	}
+	if remote.Version < minProtocolVersion || remote.MinVersion > ProtocolVersion {
+		return fmt.Errorf("%w: peer speaks versions %d to %d, we speak %d to %d",
+			ErrIncompatiblePeer, remote.MinVersion, remote.Version, minProtocolVersion, ProtocolVersion)
+	}
+
+	remoteFeatures := make(map[string]bool, len(remote.Features))
+	for _, f := range remote.Features {
+		remoteFeatures[f] = true
+	}
+	for _, f := range p.capabilities.Required {
+		if !remoteFeatures[f] {
+			return fmt.Errorf("%w: missing required feature %q", ErrIncompatiblePeer, f)
+		}
+	}
+	common := make([]string, 0, len(local))
+	for _, f := range local {
+		if remoteFeatures[f] {
+			common = append(common, f)
+			delete(remoteFeatures, f)
+		}
+	}
+	sort.Strings(common)
+
+	version := remote.Version
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+	conn.capabilities = &PeerCapabilities{
+		Version:  version,
+		Features: common,
+		Metadata: remote.Metadata,
+	}
+	// Only frame or compress messages if the remote will understand them.
+	conn.framing = conn.capabilities.Has(FeatureFraming)
+	conn.compression = conn.framing && conn.capabilities.Has(FeatureCompression)
+	if conn.capabilities.Has(FeatureStreams) {
+		conn.streams = &streamSet{
+			accept: make(chan *webrtcNetConn, maxPendingStreams),
+			closed: make(chan struct{}),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package gop2pt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCapabilitiesHandshake(t *testing.T) {
+	a := New("caps", nil, WithCapabilities(Capabilities{
+		Features: []string{"chat", "files"},
+		Metadata: map[string]string{"name": "a"},
+	}), WithCompression(), WithStreams())
+	b := New("caps", nil, WithCapabilities(Capabilities{
+		Features: []string{"files", "video"},
+		Required: []string{FeatureFraming},
+		Metadata: map[string]string{"name": "b"},
+	}), WithCompression(), WithStreams())
+	connA, connB := connPair(a.PeerID(), b.PeerID())
+	if errA, errB := runHandshakes(connA, a.capabilitiesHandshake, connB, b.capabilitiesHandshake); errA != nil || errB != nil {
+		t.Fatalf("handshake failed: %v, %v", errA, errB)
+	}
+
+	want := []string{FeatureCompression, "files", FeatureFraming, FeatureStreams}
+	for _, tc := range []struct {
+		conn *webrtcNetConn
+		name string
+	}{{connA, "b"}, {connB, "a"}} {
+		caps := tc.conn.Capabilities()
+		if caps.Version != ProtocolVersion || !reflect.DeepEqual(caps.Features, want) || caps.Metadata["name"] != tc.name {
+			t.Errorf("negotiated %+v, want version %d, features %q and the remote's metadata", caps, ProtocolVersion, want)
+		}
+		if !tc.conn.framing || !tc.conn.compression || tc.conn.streams == nil {
+			t.Errorf("negotiated features not enabled: framing %v, compression %v, streams %v", tc.conn.framing, tc.conn.compression, tc.conn.streams != nil)
+		}
+	}
+}
+
+func TestCapabilitiesHandshakeOneSided(t *testing.T) {
+	a := New("caps", nil, WithCompression(), WithStreams())
+	b := New("caps", nil, WithCapabilities(Capabilities{}))
+	connA, connB := connPair(a.PeerID(), b.PeerID())
+	if errA, errB := runHandshakes(connA, a.capabilitiesHandshake, connB, b.capabilitiesHandshake); errA != nil || errB != nil {
+		t.Fatalf("handshake failed: %v, %v", errA, errB)
+	}
+	if len(connA.Capabilities().Features) != 0 {
+		t.Fatalf("negotiated %q with a peer that supports nothing", connA.Capabilities().Features)
+	}
+	if connA.framing || connA.compression || connA.streams != nil {
+		t.Fatal("features used with a peer that didn't advertise them")
+	}
+	if _, err := connA.OpenStream(context.Background()); !errors.Is(err, ErrStreamsNotNegotiated) {
+		t.Fatalf("OpenStream returned %v, want %v", err, ErrStreamsNotNegotiated)
+	}
+}
+
+func TestCapabilitiesHandshakeMissingFeature(t *testing.T) {
+	a := New("caps", nil, WithCapabilities(Capabilities{Required: []string{"files"}}))
+	b := New("caps", nil, WithCapabilities(Capabilities{Features: []string{"chat"}}))
+	connA, connB := connPair(a.PeerID(), b.PeerID())
+	errA, errB := runHandshakes(connA, a.capabilitiesHandshake, connB, b.capabilitiesHandshake)
+	if !errors.Is(errA, ErrIncompatiblePeer) {
+		t.Fatalf("got error %v, want %v", errA, ErrIncompatiblePeer)
+	}
+	// b doesn't require anything, so the handshake succeeds on its side and a drops the conn.
+	if errB != nil {
+		t.Fatalf("peer without requirements failed with %v", errB)
+	}
+}
+
+func TestCapabilitiesHandshakeIncompatibleVersion(t *testing.T) {
+	a := New("caps", nil, WithCapabilities(Capabilities{}))
+	connA, connRemote := connPair(a.PeerID(), PeerID{1})
+	go writeHandshakeMessage(connRemote, capabilitiesMessage{
+		Protocol:   protocolName,
+		Version:    ProtocolVersion + 2,
+		MinVersion: ProtocolVersion + 1,
+	})
+	if err := a.capabilitiesHandshake(connA); !errors.Is(err, ErrIncompatiblePeer) {
+		t.Fatalf("got error %v, want %v", err, ErrIncompatiblePeer)
+	}
+}
+
+// A peer that doesn't run the handshake starts right away with application data.
+func TestCapabilitiesHandshakePeerWithout(t *testing.T) {
+	for _, data := range [][]byte{[]byte("hello"), []byte(`{"protocol":"other"}`)} {
+		a := New("caps", nil, WithCapabilities(Capabilities{}))
+		connA, connRemote := connPair(a.PeerID(), PeerID{1})
+		go connRemote.WriteDataChannel(data, false)
+		err := a.capabilitiesHandshake(connA)
+		if err == nil {
+			t.Fatalf("handshake succeeded with a peer that sent %q", data)
+		}
+		if bytes.HasPrefix(data, []byte("{")) && !errors.Is(err, ErrIncompatiblePeer) {
+			t.Errorf("got error %v for another protocol, want %v", err, ErrIncompatiblePeer)
+		}
+	}
+}
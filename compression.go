@@ -0,0 +1,58 @@
+package gop2pt
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// FeatureCompression is advertised in the capability handshake with WithCompression.
+const FeatureCompression = "compression"
+
+// WithCompression compresses the payload of every framed record with DEFLATE (RFC 1951), each on
+// its own so records can be inflated independently, like permessage-deflate without context
+// takeover. It implies WithMessageFraming, and compression is only used with peers that advertise
+// both FeatureFraming and FeatureCompression.
+func WithCompression() Option {
+	return func(p *P2PT) {
+		p.compression = true
+		WithMessageFraming()(p)
+	}
+}
+
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	},
+}
+
+func deflate(p []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&b)
+	if _, err := w.Write(p); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// inflate decompresses a record, refusing to expand it beyond maxReassembledMessageSize.
+func inflate(p []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(p))
+	defer r.Close()
+	msg, err := io.ReadAll(io.LimitReader(r, maxReassembledMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("inflating message: %w", err)
+	}
+	if len(msg) > maxReassembledMessageSize {
+		return nil, fmt.Errorf("%w: message inflates beyond %d bytes", ErrMessageTooLarge, maxReassembledMessageSize)
+	}
+	return msg, nil
+}
@@ -0,0 +1,82 @@
+package gop2pt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func compressedConn(chunkSize int) (*webrtcNetConn, *messagePipe) {
+	conn, mp := framedConn(chunkSize)
+	conn.compression = true
+	return conn, mp
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	conn, mp := compressedConn(100)
+	msg := bytes.Repeat([]byte("compress me "), 1000)
+	if err := conn.WriteMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(mp.messages); sent*100 >= len(msg)/10 {
+		t.Errorf("%d byte message sent in %d messages of up to 100 bytes, want it compressed", len(msg), sent)
+	}
+	if err := conn.WriteMessage(nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range [][]byte{msg, {}} {
+		got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("read back %d bytes, want %d", len(got), len(want))
+		}
+	}
+}
+
+func TestCompressionWriteRead(t *testing.T) {
+	conn, _ := compressedConn(8)
+	conn.Write([]byte("hello "))
+	conn.Write([]byte{0, 1})
+	conn.WriteMessage([]byte("world"))
+
+	buf := make([]byte, 4)
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "hell" {
+		t.Fatalf("Read returned %q, %v", buf[:n], err)
+	}
+	// ReadMessage picks up where Read stopped.
+	rest, err := conn.ReadMessage()
+	if err != nil || string(rest) != "o " {
+		t.Fatalf("ReadMessage returned %q, %v, want the rest of the first write", rest, err)
+	}
+	all, err := io.ReadAll(conn)
+	if err != nil || string(all) != "\x00\x01world" {
+		t.Fatalf("read %q, %v", all, err)
+	}
+}
+
+func TestCompressionBomb(t *testing.T) {
+	bomb, err := deflate(make([]byte, maxReassembledMessageSize+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, mp := compressedConn(maxSendMessageSize)
+	record := make([]byte, frameHeaderSize, frameHeaderSize+len(bomb))
+	binary.BigEndian.PutUint32(record, uint32(len(bomb)))
+	mp.messages = [][]byte{append(record, bomb...)}
+	if _, err := conn.ReadMessage(); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("got error %v, want %v", err, ErrMessageTooLarge)
+	}
+}
+
+func TestCompressionCorrupt(t *testing.T) {
+	conn, mp := compressedConn(100)
+	mp.messages = [][]byte{{0, 0, 0, 3, 0xff, 0xff, 0xff}}
+	if _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("corrupt record inflated")
+	}
+}
@@ -0,0 +1,94 @@
+// Package event describes the tracker, signaling and peer lifecycle events reported by gop2pt.
+package event
+
+import (
+	"time"
+
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+type Type int
+
+const (
+	// TrackerConnected is sent once the websocket to a tracker is established.
+	TrackerConnected Type = iota + 1
+	// TrackerConnectFailed is sent when dialing a tracker fails. Err holds the reason.
+	TrackerConnectFailed
+	// TrackerDisconnected is sent when an established tracker websocket ends.
+	TrackerDisconnected
+	// AnnounceSucceeded is sent once an announce carrying our offers was written to a tracker.
+	AnnounceSucceeded
+	// AnnounceFailed is sent when an announce could not be created or sent.
+	AnnounceFailed
+	// OfferTimedOut is sent when one of our offers got no usable answer in time.
+	OfferTimedOut
+	// AnswerReceived is sent when a peer answers one of our offers.
+	AnswerReceived
+	// OfferReceived is sent when a tracker relays an offer from another peer.
+	OfferReceived
+	// AnswerTimedOut is sent when a peer we answered never opened a data channel.
+	AnswerTimedOut
+	// SignalingFailed is sent when an offer or answer from a peer could not be used.
+	SignalingFailed
+	// PeerConnected is sent when a data channel to a peer opens.
+	PeerConnected
+	// PeerDisconnected is sent when a peer's data channel goes away. Err is nil if it was closed
+	// locally.
+	PeerDisconnected
+	// PeerReconnected is sent when a peer that was lost is connected again.
+	PeerReconnected
+	// PeerReconnectAbandoned is sent when a lost peer could not be reconnected in time.
+	PeerReconnectAbandoned
+	// PeerRejected is sent when a peer fails a handshake and is dropped before reaching Accept.
+	PeerRejected
+	// OfferSent is sent for each of our offers in an announce written to a tracker, before the
+	// AnnounceSucceeded for that swarm.
+	OfferSent
+)
+
+var typeNames = map[Type]string{
+	TrackerConnected:       "tracker connected",
+	TrackerConnectFailed:   "tracker connect failed",
+	TrackerDisconnected:    "tracker disconnected",
+	AnnounceSucceeded:      "announce succeeded",
+	AnnounceFailed:         "announce failed",
+	OfferTimedOut:          "offer timed out",
+	AnswerReceived:         "answer received",
+	OfferReceived:          "offer received",
+	AnswerTimedOut:         "answer timed out",
+	SignalingFailed:        "signaling failed",
+	PeerConnected:          "peer connected",
+	PeerDisconnected:       "peer disconnected",
+	PeerReconnected:        "peer reconnected",
+	PeerReconnectAbandoned: "peer reconnect abandoned",
+	PeerRejected:           "peer rejected",
+	OfferSent:              "offer sent",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "unknown event"
+}
+
+// Event is a single lifecycle notification. Fields that don't apply to the Type are left empty.
+type Event struct {
+	Type Type
+	Time time.Time
+	// Announce URL of the tracker involved.
+	Tracker string
+	// Swarm the event relates to.
+	InfoHash utils.InfoHash
+	// Peer ID of the remote peer.
+	PeerID utils.PeerID
+	// Binary offer ID the event relates to.
+	OfferID string
+	// Whether the data channel was opened from an offer we made.
+	LocalOffered bool
+	Err          error
+}
+
+// Handler receives events. Handlers are called synchronously from the signaling goroutines and
+// must not block.
+type Handler func(Event)
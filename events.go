@@ -0,0 +1,69 @@
+package gop2pt
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/DaniilSokolyuk/gop2pt/event"
+	"github.com/DaniilSokolyuk/gop2pt/metrics"
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
+)
+
+// WithEventHandler registers handler for tracker, signaling and peer lifecycle events from the
+// start. See OnEvent.
+func WithEventHandler(handler event.Handler) Option {
+	return func(p *P2PT) {
+		p.OnEvent(handler)
+	}
+}
+
+// WithMetrics records tracker, signaling and conn metrics into m, to be served to Prometheus. One
+// Metrics can be shared by several P2PTs.
+func WithMetrics(m *metrics.Metrics) Option {
+	return WithEventHandler(m.OnEvent)
+}
+
+// WithTracerProvider traces the signaling of every offer with OpenTelemetry: creating it, ICE
+// gathering, sending it to the tracker, the answer, SetRemoteDescription and the data channel
+// opening. Each offer gets its own trace, linked by the offer ID to the trace of the remote peer
+// answering it, and every announce links to the offers it sent.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(p *P2PT) {
+		p.tracer = tp.Tracer(webtorrent.TracerName)
+	}
+}
+
+// OnEvent registers handler to receive lifecycle events and returns a function that unregisters
+// it. Handlers are called synchronously and must not block.
+func (p *P2PT) OnEvent(handler event.Handler) (remove func()) {
+	p.handlersMu.Lock()
+	defer p.handlersMu.Unlock()
+	if p.handlers == nil {
+		p.handlers = make(map[int]event.Handler)
+	}
+	id := p.nextHandler
+	p.nextHandler++
+	p.handlers[id] = handler
+	return func() {
+		p.handlersMu.Lock()
+		defer p.handlersMu.Unlock()
+		delete(p.handlers, id)
+	}
+}
+
+func (p *P2PT) emit(e event.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	p.handlersMu.Lock()
+	handlers := make([]event.Handler, 0, len(p.handlers))
+	for _, h := range p.handlers {
+		handlers = append(handlers, h)
+	}
+	p.handlersMu.Unlock()
+
+	for _, h := range handlers {
+		h(e)
+	}
+}
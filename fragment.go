@@ -0,0 +1,217 @@
+package gop2pt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
+)
+
+// pion can't send larger messages, whatever the remote accepts.
+const maxSendMessageSize = 65536
+
+// Bounds the memory a peer can make us spend reassembling one framed message.
+const maxReassembledMessageSize = 16 << 20
+
+// Message framing, used with peers that negotiated FeatureFraming. The data channel carries a byte
+// stream of records, each a 4 byte big-endian payload length followed by the payload, cut into
+// data channel messages wherever the remote's max-message-size requires. Message boundaries carry
+// no meaning, so any peer that can prefix lengths and buffer a byte stream can take part,
+// including browsers, whatever their own message size limits.
+const frameHeaderSize = 4
+
+var ErrMessageTooLarge = errors.New("message too large")
+
+// WithMessageFraming lets WriteMessage send messages of any size and ReadMessage receive them
+// whole, using the length-prefixed framing described at frameHeaderSize. It enables the
+// capability handshake, see WithCapabilities, and framing is only used with peers that advertise
+// FeatureFraming in it. With other peers WriteMessage and ReadMessage behave as without this
+// option. With framing, every Write is sent as one record and Read returns the payloads of records
+// as a continuous stream.
+func WithMessageFraming() Option {
+	return func(p *P2PT) {
+		p.messageFraming = true
+		if p.capabilities == nil {
+			p.capabilities = &Capabilities{}
+		}
+	}
+}
+
+// writeChunkSize is the largest message we may send to the remote described by dcc. The remote's
+// limit is taken as given, however small.
+func writeChunkSize(dcc webtorrent.DataChannelContext) int {
+	size := webtorrent.MaxMessageSize(dcc.Remote)
+	if size == 0 || size > maxSendMessageSize {
+		size = maxSendMessageSize
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// Write sends p as a byte stream, split into as many messages as the remote's max-message-size
+// requires.
+func (c *webrtcNetConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.framing {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		if err := c.writeRecord(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	written := 0
+	for written < len(p) {
+		end := written + c.chunkSize
+		if end > len(p) {
+			end = len(p)
+		}
+		n, err := c.ReadWriteCloser.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (c *webrtcNetConn) WriteMessage(p []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if !c.framing {
+		if len(p) > c.chunkSize {
+			return fmt.Errorf("%w: %d bytes, remote accepts %d", ErrMessageTooLarge, len(p), c.chunkSize)
+		}
+		_, err := c.ReadWriteCloser.Write(p)
+		return err
+	}
+	return c.writeRecord(p)
+}
+
+// writeRecord sends p with its length prefix, in messages of at most chunkSize bytes.
+func (c *webrtcNetConn) writeRecord(p []byte) error {
+	if len(p) > maxReassembledMessageSize {
+		return fmt.Errorf("%w: %d bytes, peers accept %d", ErrMessageTooLarge, len(p), maxReassembledMessageSize)
+	}
+	if c.compression {
+		var err error
+		if p, err = deflate(p); err != nil {
+			return err
+		}
+	}
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(p)))
+	chunk := make([]byte, 0, min(c.chunkSize, len(header)+len(p)))
+	for _, part := range [][]byte{header[:], p} {
+		for len(part) > 0 {
+			n := min(cap(chunk)-len(chunk), len(part))
+			chunk, part = append(chunk, part[:n]...), part[n:]
+			if len(chunk) == cap(chunk) {
+				if _, err := c.ReadWriteCloser.Write(chunk); err != nil {
+					return err
+				}
+				chunk = chunk[:0]
+			}
+		}
+	}
+	if len(chunk) > 0 {
+		_, err := c.ReadWriteCloser.Write(chunk)
+		return err
+	}
+	return nil
+}
+
+func (c *webrtcNetConn) ReadMessage() ([]byte, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if !c.framing {
+		if len(c.pending) == 0 {
+			if err := c.fill(); err != nil {
+				return nil, err
+			}
+		}
+		msg := append([]byte(nil), c.pending...)
+		c.pending = nil
+		return msg, nil
+	}
+
+	// With compression, Read may have left part of the last message.
+	if len(c.inflated) > 0 {
+		msg := c.inflated
+		c.inflated = nil
+		return msg, nil
+	}
+	return c.readRecord()
+}
+
+// readRecord reads the next record whole, inflating it with compression. Without compression,
+// Read may have consumed the start of the current record already, in which case it returns the
+// rest.
+func (c *webrtcNetConn) readRecord() ([]byte, error) {
+	if c.recordLeft == 0 {
+		if err := c.readRecordHeader(); err != nil {
+			return nil, err
+		}
+	}
+	msg := make([]byte, 0, min(c.recordLeft, maxMessageSize))
+	for c.recordLeft > 0 {
+		if len(c.pending) == 0 {
+			if err := c.fill(); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		}
+		n := min(c.recordLeft, len(c.pending))
+		msg = append(msg, c.pending[:n]...)
+		c.pending = c.pending[n:]
+		c.recordLeft -= n
+	}
+	if c.compression {
+		return inflate(msg)
+	}
+	return msg, nil
+}
+
+// readRecordHeader reads the length prefix of the next record into recordLeft.
+func (c *webrtcNetConn) readRecordHeader() error {
+	var header [frameHeaderSize]byte
+	for read := 0; read < len(header); {
+		if len(c.pending) == 0 {
+			if err := c.fill(); err != nil {
+				if read > 0 {
+					return unexpectedEOF(err)
+				}
+				return err
+			}
+		}
+		n := copy(header[read:], c.pending)
+		c.pending = c.pending[n:]
+		read += n
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxReassembledMessageSize {
+		return fmt.Errorf("%w: peer sent a %d byte message", ErrMessageTooLarge, size)
+	}
+	c.recordLeft = int(size)
+	return nil
+}
+
+// unexpectedEOF reports a stream ending inside a record as io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,211 @@
+package gop2pt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// messagePipe is one direction of a data channel, keeping message boundaries.
+type messagePipe struct {
+	messages [][]byte
+}
+
+func (mp *messagePipe) Read(p []byte) (int, error) {
+	n, _, err := mp.ReadDataChannel(p)
+	return n, err
+}
+
+func (mp *messagePipe) ReadDataChannel(p []byte) (int, bool, error) {
+	if len(mp.messages) == 0 {
+		return 0, false, io.EOF
+	}
+	msg := mp.messages[0]
+	if len(msg) > len(p) {
+		return 0, false, io.ErrShortBuffer
+	}
+	mp.messages = mp.messages[1:]
+	return copy(p, msg), false, nil
+}
+
+func (mp *messagePipe) Write(p []byte) (int, error) {
+	return mp.WriteDataChannel(p, false)
+}
+
+func (mp *messagePipe) WriteDataChannel(p []byte, _ bool) (int, error) {
+	mp.messages = append(mp.messages, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func (mp *messagePipe) Close() error { return nil }
+
+func framedConn(chunkSize int) (*webrtcNetConn, *messagePipe) {
+	mp := &messagePipe{}
+	return &webrtcNetConn{ReadWriteCloser: mp, chunkSize: chunkSize, framing: true}, mp
+}
+
+func TestFramingRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, 5, 6, 7, 100} {
+		conn, mp := framedConn(10)
+		msg := bytes.Repeat([]byte{0xab}, size)
+		if err := conn.WriteMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+		if want := (frameHeaderSize + size + 9) / 10; len(mp.messages) != want {
+			t.Errorf("%d byte message sent in %d data channel messages, want %d", size, len(mp.messages), want)
+		}
+		for i, m := range mp.messages {
+			if len(m) > 10 {
+				t.Errorf("data channel message %d is %d bytes, larger than the remote accepts", i, len(m))
+			}
+		}
+		if got := binary.BigEndian.Uint32(mp.messages[0]); got != uint32(size) {
+			t.Errorf("length prefix %d, want %d", got, size)
+		}
+		got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Errorf("reassembled %d bytes, want %d", len(got), size)
+		}
+	}
+}
+
+func TestFramingTinyRemoteLimit(t *testing.T) {
+	conn, mp := framedConn(1)
+	if err := conn.WriteMessage([]byte("xy")); err != nil {
+		t.Fatal(err)
+	}
+	if len(mp.messages) != frameHeaderSize+2 {
+		t.Fatalf("sent %d messages, want one byte each", len(mp.messages))
+	}
+	got, err := conn.ReadMessage()
+	if err != nil || string(got) != "xy" {
+		t.Fatalf("ReadMessage returned %q, %v", got, err)
+	}
+
+	// Without framing, the remote's limit is honoured as is.
+	conn.framing = false
+	if _, err := conn.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if len(mp.messages) != 3 {
+		t.Fatalf("sent %d messages, want 3 of 1 byte", len(mp.messages))
+	}
+}
+
+// Write and Read keep stream semantics with framing on: the peer reads exactly the bytes written,
+// whatever they look like.
+func TestFramingWriteRead(t *testing.T) {
+	conn, _ := framedConn(4)
+	for _, p := range [][]byte{[]byte("hello"), {0, 'a', 'b'}, {1}, {}} {
+		if n, err := conn.Write(p); n != len(p) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", p, n, err)
+		}
+	}
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello\x00ab\x01"; string(got) != want {
+		t.Fatalf("read %q, want %q", got, want)
+	}
+}
+
+func TestFramingWriteReadMessage(t *testing.T) {
+	conn, _ := framedConn(4)
+	conn.Write([]byte{0, 'a', 'b'})
+	conn.WriteMessage([]byte("whole"))
+	for _, want := range []string{"\x00ab", "whole"} {
+		got, err := conn.ReadMessage()
+		if err != nil || string(got) != want {
+			t.Fatalf("ReadMessage returned %q, %v, want %q", got, err, want)
+		}
+	}
+}
+
+func TestFramingReadMessageAfterRead(t *testing.T) {
+	conn, _ := framedConn(4)
+	if err := conn.WriteMessage([]byte("abcdefgh")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage([]byte("next")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 2)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "ab" {
+		t.Fatalf("Read returned %q, want the payload without the length prefix", buf[:n])
+	}
+	rest, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "cdefgh" {
+		t.Fatalf("ReadMessage returned %q, want the rest of the message", rest)
+	}
+	next, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(next) != "next" {
+		t.Fatalf("ReadMessage returned %q, want the next message", next)
+	}
+}
+
+// Read stops at record boundaries, so a message read partly is finished by ReadMessage.
+func TestFramingReadMessageAfterFullRead(t *testing.T) {
+	conn, _ := framedConn(4)
+	if err := conn.WriteMessage([]byte("abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "def" {
+		t.Fatalf("ReadMessage returned %q, want %q", rest, "def")
+	}
+}
+
+func TestFramingMalformed(t *testing.T) {
+	conn, mp := framedConn(10)
+	mp.messages = [][]byte{{0xff, 0xff, 0xff, 0xff, 'x'}}
+	if _, err := conn.ReadMessage(); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("got error %v, want %v", err, ErrMessageTooLarge)
+	}
+
+	for _, truncated := range [][]byte{{0, 0}, {0, 0, 0, 5, 'x'}} {
+		conn, mp := framedConn(10)
+		mp.messages = [][]byte{truncated}
+		if _, err := conn.ReadMessage(); err != io.ErrUnexpectedEOF {
+			t.Errorf("reading %q got error %v, want %v", truncated, err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func TestFramingOnlyWhenNegotiated(t *testing.T) {
+	p := New("framing", nil, WithMessageFraming())
+	if p.capabilities == nil {
+		t.Fatal("WithMessageFraming didn't enable the capability handshake")
+	}
+	conn, mp := framedConn(10)
+	conn.framing = false
+	if err := conn.WriteMessage([]byte("plain")); err != nil {
+		t.Fatal(err)
+	}
+	if string(mp.messages[0]) != "plain" {
+		t.Fatalf("sent %q to a peer that didn't negotiate framing", mp.messages[0])
+	}
+}
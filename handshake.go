@@ -0,0 +1,101 @@
+package gop2pt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DaniilSokolyuk/gop2pt/event"
+	dslog "github.com/DaniilSokolyuk/gop2pt/log"
+)
+
+var defaultHandshakeTimeout = time.Second * 10
+
+var ErrHandshakeTimeout = errors.New("handshake timed out")
+
+// Large enough for any handshake message, while bounding what a peer can make us buffer.
+const maxHandshakeMessageSize = 16 * 1024
+
+// A handshake runs on a freshly opened conn before it is handed to Accept. An error drops the
+// peer. Handshakes exchange whole JSON messages, one per data channel message.
+type handshake func(conn *webrtcNetConn) error
+
+// WithHandshakeTimeout bounds how long the handshakes enabled by other options may take before the
+// peer is dropped. Defaults to 10 seconds.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(p *P2PT) {
+		p.handshakeTimeout = timeout
+	}
+}
+
+// buildHandshakes lists the enabled handshakes. Both sides must run them in the same order, so it
+// is fixed here rather than following the order of options.
+func (p *P2PT) buildHandshakes() []handshake {
+	var handshakes []handshake
+	if p.identity != nil {
+		handshakes = append(handshakes, p.identityHandshake)
+	}
+	if p.roomSecret != nil {
+		handshakes = append(handshakes, p.roomSecretHandshake)
+	}
+	if p.capabilities != nil {
+		handshakes = append(handshakes, p.capabilitiesHandshake)
+	}
+	return handshakes
+}
+
+// admit runs the configured handshakes on conn and delivers it to onConn if they all pass.
+func (p *P2PT) admit(conn *webrtcNetConn, onConn func(*webrtcNetConn)) {
+	if len(p.handshakes) == 0 {
+		onConn(conn)
+		return
+	}
+
+	timer := time.AfterFunc(p.handshakeTimeout, func() {
+		conn.Close()
+	})
+	for _, h := range p.handshakes {
+		if err := h(conn); err != nil {
+			if !timer.Stop() {
+				err = ErrHandshakeTimeout
+			}
+			conn.Close()
+			p.logger.Warn("rejected peer", dslog.KeyPeerID, conn.PeerID.String(), dslog.KeyOfferID, dslog.OfferID(conn.OfferId), dslog.KeyError, err)
+			p.emit(event.Event{
+				Type:         event.PeerRejected,
+				PeerID:       conn.PeerID,
+				OfferID:      conn.OfferId,
+				LocalOffered: conn.LocalOffered,
+				Err:          err,
+			})
+			return
+		}
+	}
+	if !timer.Stop() {
+		// The timeout closed the conn just as the last handshake finished.
+		return
+	}
+	onConn(conn)
+}
+
+func writeHandshakeMessage(conn *webrtcNetConn, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = conn.WriteDataChannel(data, true)
+	return err
+}
+
+func readHandshakeMessage(conn *webrtcNetConn, v interface{}) error {
+	buf := make([]byte, maxHandshakeMessageSize)
+	n, _, err := conn.ReadDataChannel(buf)
+	if err != nil {
+		return fmt.Errorf("reading handshake message: %w", err)
+	}
+	if err := json.Unmarshal(buf[:n], v); err != nil {
+		return fmt.Errorf("decoding handshake message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package gop2pt
+
+import (
+	"io"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
+)
+
+// chanPipe is one end of an in-memory data channel, blocking like the real thing.
+type chanPipe struct {
+	in  <-chan []byte
+	out chan<- []byte
+}
+
+func (cp *chanPipe) Read(p []byte) (int, error) {
+	n, _, err := cp.ReadDataChannel(p)
+	return n, err
+}
+
+func (cp *chanPipe) ReadDataChannel(p []byte) (int, bool, error) {
+	select {
+	case msg := <-cp.in:
+		if len(msg) > len(p) {
+			return 0, false, io.ErrShortBuffer
+		}
+		return copy(p, msg), true, nil
+	case <-time.After(5 * time.Second):
+		return 0, false, io.EOF
+	}
+}
+
+func (cp *chanPipe) Write(p []byte) (int, error) {
+	return cp.WriteDataChannel(p, false)
+}
+
+func (cp *chanPipe) WriteDataChannel(p []byte, _ bool) (int, error) {
+	cp.out <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+func (cp *chanPipe) Close() error { return nil }
+
+// testDescription is a session description with just enough in it for the handshakes.
+func testDescription(fingerprint string) webrtc.SessionDescription {
+	return webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  "v=0\r\no=- 0 0 IN IP4 0.0.0.0\r\ns=-\r\nt=0 0\r\na=fingerprint:sha-256 " + fingerprint + "\r\n",
+	}
+}
+
+const (
+	fingerprintA = "AA:AA:AA:AA"
+	fingerprintB = "BB:BB:BB:BB"
+)
+
+// connPair returns the two ends of a connection between peers a and b, as seen by a and by b.
+func connPair(a, b PeerID) (*webrtcNetConn, *webrtcNetConn) {
+	ab, ba := make(chan []byte, 4), make(chan []byte, 4)
+	atA := &webrtcNetConn{
+		ReadWriteCloser: &chanPipe{in: ba, out: ab},
+		DataChannelContext: webtorrent.DataChannelContext{
+			Local:  testDescription(fingerprintA),
+			Remote: testDescription(fingerprintB),
+			PeerID: b,
+		},
+	}
+	atB := &webrtcNetConn{
+		ReadWriteCloser: &chanPipe{in: ab, out: ba},
+		DataChannelContext: webtorrent.DataChannelContext{
+			Local:  testDescription(fingerprintB),
+			Remote: testDescription(fingerprintA),
+			PeerID: a,
+		},
+	}
+	return atA, atB
+}
+
+// runHandshakes runs ha on conn a and hb on conn b concurrently and returns their errors.
+func runHandshakes(a *webrtcNetConn, ha handshake, b *webrtcNetConn, hb handshake) (errA, errB error) {
+	errs := make(chan error, 1)
+	go func() { errs <- hb(b) }()
+	errA = ha(a)
+	return errA, <-errs
+}
+
+// echo answers every message read from conn with the same message, like an attacker replaying
+// our own handshake back at us.
+func echo(conn *webrtcNetConn) {
+	go func() {
+		buf := make([]byte, maxHandshakeMessageSize)
+		for {
+			n, _, err := conn.ReadDataChannel(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteDataChannel(buf[:n], true)
+		}
+	}()
+}
@@ -0,0 +1,89 @@
+package gop2pt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	"github.com/DaniilSokolyuk/gop2pt/identity"
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
+)
+
+const identityContext = "gop2pt identity v1"
+
+var ErrIdentityMismatch = errors.New("peer identity does not match its peer ID")
+
+// WithIdentity announces the peer ID derived from id and requires every peer to prove possession
+// of the key behind its own peer ID before the conn reaches Accept. The proof is bound to the DTLS
+// fingerprints of the connection, so it can't be replayed on another one. All peers must use
+// identities. It overrides the other peer ID options. Offers and answers sent through trackers are
+// signed with id as well, see RequireSignedSDP.
+func WithIdentity(id *identity.Identity) Option {
+	return func(p *P2PT) {
+		p.identity = id
+	}
+}
+
+// RequireSignedSDP rejects offers and answers that weren't signed by the identity behind the
+// sender's peer ID, so a tracker can't substitute its own DTLS fingerprints to intercept the
+// connection. Signatures that are present are always checked. Use with WithIdentity.
+func RequireSignedSDP() Option {
+	return func(p *P2PT) {
+		p.requireSignedSDP = true
+	}
+}
+
+type identityMessage struct {
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+// identityProof is what each side signs: its own peer ID and the DTLS fingerprints of both ends,
+// sender first.
+func identityProof(peerID PeerID, senderFingerprint, receiverFingerprint string) []byte {
+	var b bytes.Buffer
+	b.WriteString(identityContext)
+	b.WriteByte(0)
+	b.Write(peerID[:])
+	b.WriteString(senderFingerprint)
+	b.WriteByte(0)
+	b.WriteString(receiverFingerprint)
+	return b.Bytes()
+}
+
+func (p *P2PT) identityHandshake(conn *webrtcNetConn) error {
+	local, err := webtorrent.Fingerprint(conn.Local)
+	if err != nil {
+		return fmt.Errorf("local description: %w", err)
+	}
+	remote, err := webtorrent.Fingerprint(conn.Remote)
+	if err != nil {
+		return fmt.Errorf("remote description: %w", err)
+	}
+
+	err = writeHandshakeMessage(conn, identityMessage{
+		PublicKey: p.identity.PublicKey(),
+		Signature: p.identity.Sign(identityProof(p.peerID, local, remote)),
+	})
+	if err != nil {
+		return fmt.Errorf("sending identity: %w", err)
+	}
+
+	var msg identityMessage
+	if err := readHandshakeMessage(conn, &msg); err != nil {
+		return err
+	}
+	pub := ed25519.PublicKey(msg.PublicKey)
+	if len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: bad public key length %d", ErrIdentityMismatch, len(pub))
+	}
+	if identity.PeerIDFromPublicKey(pub) != conn.PeerID {
+		return ErrIdentityMismatch
+	}
+	if !identity.Verify(pub, identityProof(conn.PeerID, remote, local), msg.Signature) {
+		return fmt.Errorf("%w: bad signature", ErrIdentityMismatch)
+	}
+	conn.publicKey = pub
+	return nil
+}
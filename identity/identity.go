@@ -0,0 +1,106 @@
+// Package identity provides Ed25519 peer identities. The peer ID of an identity is derived from
+// its public key, so a peer can prove that it owns the peer ID it announces.
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+const pemType = "GOP2PT ED25519 PRIVATE KEY"
+
+type Identity struct {
+	privateKey ed25519.PrivateKey
+}
+
+// Generate creates a new random identity.
+func Generate() (*Identity, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{privateKey: priv}, nil
+}
+
+// FromPrivateKey wraps an existing Ed25519 private key.
+func FromPrivateKey(priv ed25519.PrivateKey) (*Identity, error) {
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("private key is %d bytes, want %d", len(priv), ed25519.PrivateKeySize)
+	}
+	return &Identity{privateKey: priv}, nil
+}
+
+// LoadOrGenerate loads the identity saved at path, or generates one and saves it there if the file
+// doesn't exist yet.
+func LoadOrGenerate(path string) (*Identity, error) {
+	id, err := Load(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return id, err
+	}
+	id, err = Generate()
+	if err != nil {
+		return nil, err
+	}
+	return id, id.Save(path)
+}
+
+// Load reads an identity written by Save.
+func Load(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemType {
+		return nil, fmt.Errorf("no %s block in %q", pemType, path)
+	}
+	if len(block.Bytes) != ed25519.SeedSize {
+		return nil, fmt.Errorf("key seed in %q is %d bytes, want %d", path, len(block.Bytes), ed25519.SeedSize)
+	}
+	return &Identity{privateKey: ed25519.NewKeyFromSeed(block.Bytes)}, nil
+}
+
+// Save writes the identity's private key seed to path as PEM, readable only by the owner.
+func (id *Identity) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating identity directory: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: id.privateKey.Seed()})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("saving identity: %w", err)
+	}
+	return nil
+}
+
+func (id *Identity) PublicKey() ed25519.PublicKey {
+	return id.privateKey.Public().(ed25519.PublicKey)
+}
+
+// PeerID returns the peer ID derived from the identity's public key.
+func (id *Identity) PeerID() utils.PeerID {
+	return PeerIDFromPublicKey(id.PublicKey())
+}
+
+func (id *Identity) Sign(message []byte) []byte {
+	return ed25519.Sign(id.privateKey, message)
+}
+
+// PeerIDFromPublicKey derives a peer ID as the first 20 bytes of the SHA-256 of the public key.
+func PeerIDFromPublicKey(pub ed25519.PublicKey) (peerID utils.PeerID) {
+	sum := sha256.Sum256(pub)
+	copy(peerID[:], sum[:])
+	return
+}
+
+// Verify reports whether sig is a valid signature of message by pub.
+func Verify(pub ed25519.PublicKey, message, sig []byte) bool {
+	return len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, message, sig)
+}
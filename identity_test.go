@@ -0,0 +1,63 @@
+package gop2pt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DaniilSokolyuk/gop2pt/identity"
+)
+
+func newIdentityPeer(t *testing.T) *P2PT {
+	t.Helper()
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(t.Name(), nil, WithIdentity(id))
+}
+
+func TestIdentityHandshake(t *testing.T) {
+	a, b := newIdentityPeer(t), newIdentityPeer(t)
+	connA, connB := connPair(a.PeerID(), b.PeerID())
+	errA, errB := runHandshakes(connA, a.identityHandshake, connB, b.identityHandshake)
+	if errA != nil || errB != nil {
+		t.Fatalf("handshake failed: %v, %v", errA, errB)
+	}
+	if !connA.PublicKey().Equal(b.identity.PublicKey()) || !connB.PublicKey().Equal(a.identity.PublicKey()) {
+		t.Fatal("conns don't report the verified keys")
+	}
+}
+
+func TestIdentityHandshakeWrongKey(t *testing.T) {
+	a, b, impostor := newIdentityPeer(t), newIdentityPeer(t), newIdentityPeer(t)
+	// The impostor announced b's peer ID but only holds its own key.
+	connA, connImpostor := connPair(a.PeerID(), b.PeerID())
+	errA, _ := runHandshakes(connA, a.identityHandshake, connImpostor, impostor.identityHandshake)
+	if !errors.Is(errA, ErrIdentityMismatch) {
+		t.Fatalf("got error %v, want %v", errA, ErrIdentityMismatch)
+	}
+	if connA.PublicKey() != nil {
+		t.Fatal("rejected key reported by the conn")
+	}
+}
+
+func TestIdentityHandshakeReflected(t *testing.T) {
+	a := newIdentityPeer(t)
+	// Someone without a key of their own announced a's peer ID and plays a's proof back.
+	connA, connAttacker := connPair(a.PeerID(), a.PeerID())
+	echo(connAttacker)
+	if err := a.identityHandshake(connA); !errors.Is(err, ErrIdentityMismatch) {
+		t.Fatalf("got error %v, want %v", err, ErrIdentityMismatch)
+	}
+}
+
+func TestIdentityHandshakeFingerprintMismatch(t *testing.T) {
+	a, b := newIdentityPeer(t), newIdentityPeer(t)
+	connA, connB := connPair(a.PeerID(), b.PeerID())
+	// A tracker swapped in its own fingerprint, so b sees a different connection than a does.
+	connB.Remote = testDescription("CC:CC:CC:CC")
+	errA, errB := runHandshakes(connA, a.identityHandshake, connB, b.identityHandshake)
+	if !errors.Is(errA, ErrIdentityMismatch) || !errors.Is(errB, ErrIdentityMismatch) {
+		t.Fatalf("got errors %v, %v, want %v on both sides", errA, errB, ErrIdentityMismatch)
+	}
+}
@@ -0,0 +1,98 @@
+package gop2pt
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+var ErrInvalidMagnet = errors.New("invalid magnet URI")
+
+// InfoHashFromV2 truncates a BitTorrent v2 SHA-256 info hash to the 20 bytes announced to trackers,
+// as BEP 52 specifies.
+func InfoHashFromV2(infoHash [32]byte) InfoHash {
+	return utils.InfoHashFromV2(infoHash)
+}
+
+// NewWithInfoHash joins the swarm of infoHash, for example that of an existing torrent, instead of
+// deriving it from an identifier. See ParseInfoHash for hex and base32 strings. WithRoomSecret
+// still makes peers prove the secret, but doesn't change the info hash.
+func NewWithInfoHash(infoHash InfoHash, announceURLs []string, opts ...Option) *P2PT {
+	p2pt := newP2PT(announceURLs, opts)
+	p2pt.infoHash = infoHash
+	return p2pt
+}
+
+// NewFromMagnet joins the swarm of a magnet URI. It announces to the WebSocket trackers among the
+// URI's tr and ws parameters, followed by announceURLs. Trackers using other schemes are skipped.
+func NewFromMagnet(magnetURI string, announceURLs []string, opts ...Option) (*P2PT, error) {
+	infoHash, trackers, err := parseMagnet(magnetURI)
+	if err != nil {
+		return nil, err
+	}
+	trackers = append(trackers, announceURLs...)
+	if len(trackers) == 0 {
+		return nil, fmt.Errorf("%w: no WebSocket trackers", ErrInvalidMagnet)
+	}
+	return NewWithInfoHash(infoHash, trackers, opts...), nil
+}
+
+// parseMagnet returns the info hash of a magnet URI, preferring the v1 hash of hybrid torrents,
+// and its WebSocket trackers.
+func parseMagnet(magnetURI string) (infoHash InfoHash, trackers []string, err error) {
+	u, err := url.Parse(magnetURI)
+	if err != nil {
+		return infoHash, nil, fmt.Errorf("%w: %v", ErrInvalidMagnet, err)
+	}
+	if u.Scheme != "magnet" {
+		return infoHash, nil, fmt.Errorf("%w: scheme %q", ErrInvalidMagnet, u.Scheme)
+	}
+	query := u.Query()
+
+	var v1, v2 bool
+	for _, xt := range query["xt"] {
+		switch {
+		case strings.HasPrefix(xt, "urn:btih:"):
+			infoHash, err = utils.ParseInfoHash(strings.TrimPrefix(xt, "urn:btih:"))
+			if err != nil {
+				return infoHash, nil, fmt.Errorf("%w: %v", ErrInvalidMagnet, err)
+			}
+			v1 = true
+		case strings.HasPrefix(xt, "urn:btmh:") && !v1:
+			infoHash, err = parseV2Multihash(strings.TrimPrefix(xt, "urn:btmh:"))
+			if err != nil {
+				return infoHash, nil, err
+			}
+			v2 = true
+		}
+	}
+	if !v1 && !v2 {
+		return infoHash, nil, fmt.Errorf("%w: no urn:btih or urn:btmh exact topic", ErrInvalidMagnet)
+	}
+
+	for _, tracker := range append(query["tr"], query["ws"]...) {
+		if strings.HasPrefix(tracker, "ws://") || strings.HasPrefix(tracker, "wss://") {
+			trackers = append(trackers, tracker)
+		}
+	}
+	return infoHash, trackers, nil
+}
+
+// parseV2Multihash parses the hex multihash of a v2 info hash, which must be SHA-256.
+func parseV2Multihash(s string) (infoHash InfoHash, err error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return infoHash, fmt.Errorf("%w: %v", ErrInvalidMagnet, err)
+	}
+	// The multihash code for sha2-256 and the digest length.
+	if len(b) != 34 || b[0] != 0x12 || b[1] != 0x20 {
+		return infoHash, fmt.Errorf("%w: urn:btmh is not a SHA-256 multihash", ErrInvalidMagnet)
+	}
+	var v2 [32]byte
+	copy(v2[:], b[2:])
+	return utils.InfoHashFromV2(v2), nil
+}
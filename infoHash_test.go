@@ -0,0 +1,83 @@
+package gop2pt
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testBTIH = "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+	testBTMH = "1220caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e"
+)
+
+func TestParseMagnet(t *testing.T) {
+	v1, _ := hex.DecodeString(testBTIH)
+	v2, _ := hex.DecodeString(testBTMH[4:44])
+
+	for _, tc := range []struct {
+		name     string
+		uri      string
+		infoHash []byte
+		trackers []string
+	}{
+		{"v1 hex", "magnet:?xt=urn:btih:" + testBTIH, v1, nil},
+		{"v1 upper hex", "magnet:?xt=urn:btih:" + strings.ToUpper(testBTIH), v1, nil},
+		{"v1 base32", "magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK", v1, nil},
+		{"v2", "magnet:?xt=urn:btmh:" + testBTMH, v2, nil},
+		{"hybrid prefers v1", "magnet:?xt=urn:btmh:" + testBTMH + "&xt=urn:btih:" + testBTIH, v1, nil},
+		{"hybrid v1 first", "magnet:?xt=urn:btih:" + testBTIH + "&xt=urn:btmh:" + testBTMH, v1, nil},
+		{
+			"websocket trackers only",
+			"magnet:?xt=urn:btih:" + testBTIH +
+				"&tr=udp%3A%2F%2Ftracker.example%3A1337&tr=wss%3A%2F%2Ftracker.example&ws=ws%3A%2F%2Flocalhost%3A8000",
+			v1,
+			[]string{"wss://tracker.example", "ws://localhost:8000"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			infoHash, trackers, err := parseMagnet(tc.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(infoHash[:], tc.infoHash) {
+				t.Errorf("info hash %x, want %x", infoHash, tc.infoHash)
+			}
+			if !reflect.DeepEqual(trackers, tc.trackers) {
+				t.Errorf("trackers %q, want %q", trackers, tc.trackers)
+			}
+		})
+	}
+}
+
+func TestParseMagnetRejectsMalformed(t *testing.T) {
+	for _, uri := range []string{
+		"http://example.com/?xt=urn:btih:" + testBTIH,
+		"magnet:?dn=no+exact+topic",
+		"magnet:?xt=urn:btih:" + testBTIH[:38],
+		"magnet:?xt=urn:btih:zz" + testBTIH[2:],
+		"magnet:?xt=urn:btmh:" + testBTMH[:66],
+		"magnet:?xt=urn:btmh:1114" + testBTMH[4:44],
+		"magnet:?xt=urn:btmh:xx",
+		"magnet:%zz",
+	} {
+		if _, _, err := parseMagnet(uri); !errors.Is(err, ErrInvalidMagnet) {
+			t.Errorf("parseMagnet(%q) returned %v, want %v", uri, err, ErrInvalidMagnet)
+		}
+	}
+}
+
+func TestNewFromMagnetNeedsTrackers(t *testing.T) {
+	if _, err := NewFromMagnet("magnet:?xt=urn:btih:"+testBTIH, nil); !errors.Is(err, ErrInvalidMagnet) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidMagnet)
+	}
+	p, err := NewFromMagnet("magnet:?xt=urn:btih:"+testBTIH+"&tr=udp%3A%2F%2Ftracker.example", []string{"wss://tracker.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(p.infoHash[:]) != testBTIH {
+		t.Fatalf("info hash %x, want %s", p.infoHash, testBTIH)
+	}
+}
@@ -1,8 +1,35 @@
 package log
 
+import (
+	"encoding/hex"
+
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+// Logger takes a constant message followed by alternating keys and values, like log/slog. See
+// NewSlog, and the keys below for the values gop2pt logs.
 type Logger interface {
 	Error(msg string, keysAndValues ...interface{})
 	Info(msg string, keysAndValues ...interface{})
 	Debug(msg string, keysAndValues ...interface{})
 	Warn(msg string, keysAndValues ...interface{})
 }
+
+// Keys of the values gop2pt logs, the same wherever they appear. Peer IDs are logged in base58,
+// info hashes and offer IDs in hex.
+const (
+	KeyTracker  = "tracker"
+	KeyPeerID   = "peer_id"
+	KeyOfferID  = "offer_id"
+	KeyInfoHash = "info_hash"
+	// Remote network address, e.g. of a websocket.
+	KeyAddr = "addr"
+	// The pion package a pion log comes from, e.g. ice or dtls.
+	KeyScope = "scope"
+	KeyError = "err"
+)
+
+// OfferID formats a binary offer ID for logging, in hex.
+func OfferID(offerID string) string {
+	return hex.EncodeToString(utils.JsonStringToBinary(offerID))
+}
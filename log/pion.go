@@ -0,0 +1,81 @@
+package log
+
+import (
+	"fmt"
+
+	"github.com/pion/logging"
+)
+
+// PionLoggerFactory routes the logs of pion's ICE, DTLS, SCTP and other packages into Logger, with
+// the package under KeyScope. Trace logs are logged at debug level.
+type PionLoggerFactory struct {
+	Logger Logger
+	// For scopes not in ScopeLevels. The zero value, logging.LogLevelDisabled, drops their logs.
+	DefaultLevel logging.LogLevel
+	// By pion scope, such as "ice", "dtls", "sctp" or "pc".
+	ScopeLevels map[string]logging.LogLevel
+}
+
+func (f *PionLoggerFactory) NewLogger(scope string) logging.LeveledLogger {
+	level, ok := f.ScopeLevels[scope]
+	if !ok {
+		level = f.DefaultLevel
+	}
+	return &pionLogger{logger: f.Logger, scope: scope, level: level}
+}
+
+type pionLogger struct {
+	logger Logger
+	scope  string
+	level  logging.LogLevel
+}
+
+func (l *pionLogger) log(level logging.LogLevel, msg string) {
+	if l.logger == nil || level > l.level {
+		return
+	}
+	switch level {
+	case logging.LogLevelError:
+		l.logger.Error(msg, KeyScope, l.scope)
+	case logging.LogLevelWarn:
+		l.logger.Warn(msg, KeyScope, l.scope)
+	case logging.LogLevelInfo:
+		l.logger.Info(msg, KeyScope, l.scope)
+	default:
+		l.logger.Debug(msg, KeyScope, l.scope)
+	}
+}
+
+func (l *pionLogger) Trace(msg string) { l.log(logging.LogLevelTrace, msg) }
+func (l *pionLogger) Debug(msg string) { l.log(logging.LogLevelDebug, msg) }
+func (l *pionLogger) Info(msg string)  { l.log(logging.LogLevelInfo, msg) }
+func (l *pionLogger) Warn(msg string)  { l.log(logging.LogLevelWarn, msg) }
+func (l *pionLogger) Error(msg string) { l.log(logging.LogLevelError, msg) }
+
+func (l *pionLogger) Tracef(format string, args ...interface{}) {
+	l.logf(logging.LogLevelTrace, format, args)
+}
+
+func (l *pionLogger) Debugf(format string, args ...interface{}) {
+	l.logf(logging.LogLevelDebug, format, args)
+}
+
+func (l *pionLogger) Infof(format string, args ...interface{}) {
+	l.logf(logging.LogLevelInfo, format, args)
+}
+
+func (l *pionLogger) Warnf(format string, args ...interface{}) {
+	l.logf(logging.LogLevelWarn, format, args)
+}
+
+func (l *pionLogger) Errorf(format string, args ...interface{}) {
+	l.logf(logging.LogLevelError, format, args)
+}
+
+// logf only formats the message if it is logged.
+func (l *pionLogger) logf(level logging.LogLevel, format string, args []interface{}) {
+	if l.logger == nil || level > l.level {
+		return
+	}
+	l.log(level, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,98 @@
+package log
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/pion/logging"
+)
+
+// recorder is a Logger remembering what it was given.
+type recorder struct {
+	lines []string
+}
+
+func (r *recorder) record(level, msg string, keysAndValues []interface{}) {
+	r.lines = append(r.lines, fmt.Sprint(level, " ", msg, " ", keysAndValues))
+}
+
+func (r *recorder) Error(msg string, kv ...interface{}) { r.record("error", msg, kv) }
+func (r *recorder) Warn(msg string, kv ...interface{})  { r.record("warn", msg, kv) }
+func (r *recorder) Info(msg string, kv ...interface{})  { r.record("info", msg, kv) }
+func (r *recorder) Debug(msg string, kv ...interface{}) { r.record("debug", msg, kv) }
+
+func logAll(l logging.LeveledLogger) {
+	l.Trace("trace")
+	l.Debug("debug")
+	l.Info("info")
+	l.Warn("warn")
+	l.Error("error")
+	l.Tracef("%s", "tracef")
+	l.Debugf("%s", "debugf")
+	l.Infof("%s", "infof")
+	l.Warnf("%s", "warnf")
+	l.Errorf("%s", "errorf")
+}
+
+func TestPionLoggerFactoryLevels(t *testing.T) {
+	r := &recorder{}
+	f := &PionLoggerFactory{
+		Logger:       r,
+		DefaultLevel: logging.LogLevelWarn,
+		ScopeLevels: map[string]logging.LogLevel{
+			"ice":  logging.LogLevelTrace,
+			"sctp": logging.LogLevelDisabled,
+		},
+	}
+
+	logAll(f.NewLogger("dtls"))
+	want := []string{
+		"warn warn [scope dtls]",
+		"error error [scope dtls]",
+		"warn warnf [scope dtls]",
+		"error errorf [scope dtls]",
+	}
+	if !reflect.DeepEqual(r.lines, want) {
+		t.Errorf("default level logged %q, want %q", r.lines, want)
+	}
+
+	r.lines = nil
+	logAll(f.NewLogger("sctp"))
+	if len(r.lines) != 0 {
+		t.Errorf("disabled scope logged %q", r.lines)
+	}
+
+	r.lines = nil
+	logAll(f.NewLogger("ice"))
+	want = []string{
+		"debug trace [scope ice]",
+		"debug debug [scope ice]",
+		"info info [scope ice]",
+		"warn warn [scope ice]",
+		"error error [scope ice]",
+		"debug tracef [scope ice]",
+		"debug debugf [scope ice]",
+		"info infof [scope ice]",
+		"warn warnf [scope ice]",
+		"error errorf [scope ice]",
+	}
+	if !reflect.DeepEqual(r.lines, want) {
+		t.Errorf("trace level logged %q, want %q", r.lines, want)
+	}
+}
+
+func TestPionLoggerFactoryWithoutLogger(t *testing.T) {
+	f := &PionLoggerFactory{DefaultLevel: logging.LogLevelTrace}
+	logAll(f.NewLogger("ice"))
+}
+
+// Messages that aren't logged aren't formatted either.
+func TestPionLoggerSkipsFormatting(t *testing.T) {
+	f := &PionLoggerFactory{Logger: &recorder{}, DefaultLevel: logging.LogLevelError}
+	f.NewLogger("ice").Debugf("%v", formatPanics{})
+}
+
+type formatPanics struct{}
+
+func (formatPanics) String() string { panic("formatted a dropped message") }
@@ -0,0 +1,53 @@
+//go:build go1.21
+// +build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// NewSlog logs to l, or to slog.Default() if l is nil. Records carry the source of the gop2pt
+// call site rather than of the adapter.
+func NewSlog(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Error(msg string, keysAndValues ...interface{}) {
+	s.log(slog.LevelError, msg, keysAndValues)
+}
+
+func (s slogLogger) Warn(msg string, keysAndValues ...interface{}) {
+	s.log(slog.LevelWarn, msg, keysAndValues)
+}
+
+func (s slogLogger) Info(msg string, keysAndValues ...interface{}) {
+	s.log(slog.LevelInfo, msg, keysAndValues)
+}
+
+func (s slogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	s.log(slog.LevelDebug, msg, keysAndValues)
+}
+
+func (s slogLogger) log(level slog.Level, msg string, keysAndValues []interface{}) {
+	ctx := context.Background()
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	// Skip runtime.Callers, log and the Logger method.
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(keysAndValues...)
+	_ = s.l.Handler().Handle(ctx, r)
+}
@@ -0,0 +1,32 @@
+package gop2pt
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+)
+
+func TestDefaultLogPrint(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		print func(l *defaultLog)
+		want  string
+	}{
+		{"plain", func(l *defaultLog) { l.Info("connected", "tracker", "wss://tracker.example") }, `INFO: connected tracker=wss://tracker.example`},
+		{"levels", func(l *defaultLog) { l.Warn("w"); l.Error("e"); l.Debug("d") }, "WARNING: w\nERROR: e\nDEBUG: d"},
+		{"quoted", func(l *defaultLog) {
+			l.Error("failed", "err", errors.New("dial tcp: connection refused"), "empty", "", "eq", "a=b", "quote", `say "hi"`, "nl", "a\nb")
+		}, `ERROR: failed err="dial tcp: connection refused" empty="" eq="a=b" quote="say \"hi\"" nl="a\nb"`},
+		{"non-ascii", func(l *defaultLog) { l.Debug("id", "peer_id", "ÿ") }, "DEBUG: id peer_id=ÿ"},
+		{"missing value", func(l *defaultLog) { l.Debug("odd", "n", 1, "dangling") }, `DEBUG: odd n=1 dangling=!MISSING`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tc.print(&defaultLog{Logger: log.New(&buf, "", 0)})
+			if got := buf.String(); got != tc.want+"\n" {
+				t.Errorf("got %q, want %q", got, tc.want+"\n")
+			}
+		})
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"net"
 	"sync"
-	"time"
 
 	"github.com/DaniilSokolyuk/gop2pt"
 )
@@ -24,8 +23,6 @@ func main() {
 
 		go onConn(conn)
 	}
-
-	time.Sleep(time.Second * 500)
 }
 
 func onConn(conn net.Conn) {
@@ -36,14 +33,14 @@ func onConn(conn net.Conn) {
 
 	fmt.Println("onConn", conn.RemoteAddr())
 	for {
-		bytes := make([]byte, 16000)
-		i, _ := conn.Read(bytes)
-		if i == 0 {
-			fmt.Println("disconected")
+		msg, err := conn.(gop2pt.Conn).ReadMessage()
+		if err != nil {
+			fmt.Println("disconected", err)
 			conn.Close()
+			peers.Delete(conn.RemoteAddr().String())
 			break
 		}
 
-		fmt.Println("MESSAGE", i, string(bytes[:i]), conn.RemoteAddr())
+		fmt.Println("MESSAGE", len(msg), string(msg), conn.RemoteAddr())
 	}
 }
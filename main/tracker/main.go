@@ -0,0 +1,38 @@
+// Command tracker runs a WebTorrent tracker for self-hosted signaling.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/DaniilSokolyuk/gop2pt"
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent/server"
+)
+
+func main() {
+	addr := flag.String("addr", ":8000", "address to listen on")
+	interval := flag.Duration("interval", 0, "announce interval sent to clients (default 2m)")
+	peerTimeout := flag.Duration("peer-timeout", 0, "drop peers that haven't announced for this long (default 3 intervals)")
+	certFile := flag.String("cert", "", "TLS certificate file, to serve wss://")
+	keyFile := flag.String("key", "", "TLS key file")
+	flag.Parse()
+
+	tracker := &server.Server{
+		Interval:    *interval,
+		PeerTimeout: *peerTimeout,
+		Logger:      gop2pt.DefaultLogger(),
+	}
+
+	var err error
+	if *certFile != "" {
+		fmt.Printf("tracker listening on wss://%s\n", *addr)
+		err = http.ListenAndServeTLS(*addr, *certFile, *keyFile, tracker)
+	} else {
+		fmt.Printf("tracker listening on ws://%s\n", *addr)
+		err = http.ListenAndServe(*addr, tracker)
+	}
+	fmt.Println("tracker error", err)
+	os.Exit(1)
+}
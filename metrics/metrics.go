@@ -0,0 +1,203 @@
+// Package metrics exports gop2pt tracker, signaling and conn metrics to Prometheus, labelled by
+// tracker URL and room info hash. Register Metrics.OnEvent with gop2pt.WithMetrics or
+// P2PT.OnEvent, and serve Metrics from an HTTP endpoint for scraping.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/DaniilSokolyuk/gop2pt/event"
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+// Signaling that hasn't finished after this long is forgotten, so that time to connect isn't
+// tracked forever for offers whose outcome we never see.
+const signalingTimeout = 2 * time.Minute
+
+var timeToConnectBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics turns gop2pt events into Prometheus metrics.
+type Metrics struct {
+	// Holds the metrics below. Register your own to serve them from the same endpoint.
+	Registry *prometheus.Registry
+
+	dials          *prometheus.CounterVec
+	announces      *prometheus.CounterVec
+	offersSent     *prometheus.CounterVec
+	offersAnswered *prometheus.CounterVec
+	offersTimedOut *prometheus.CounterVec
+	inboundOffers  *prometheus.CounterVec
+	openConns      *prometheus.GaugeVec
+	timeToConnect  *prometheus.HistogramVec
+
+	handler   http.Handler
+	signaling signalingTracker
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		dials: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gop2pt_tracker_dials_total",
+			Help: "Websocket dials to trackers, by result.",
+		}, []string{"tracker", "result"}),
+		announces: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gop2pt_announces_total",
+			Help: "Announces to trackers, by result.",
+		}, []string{"tracker", "room", "result"}),
+		offersSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gop2pt_offers_sent_total",
+			Help: "Offers announced to trackers.",
+		}, []string{"tracker", "room"}),
+		offersAnswered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gop2pt_offers_answered_total",
+			Help: "Offers of ours that a peer answered.",
+		}, []string{"tracker", "room"}),
+		offersTimedOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gop2pt_offers_timed_out_total",
+			Help: "Offers of ours that got no usable answer in time.",
+		}, []string{"tracker", "room"}),
+		inboundOffers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gop2pt_inbound_offers_total",
+			Help: "Offers from peers relayed by trackers.",
+		}, []string{"tracker", "room"}),
+		openConns: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gop2pt_open_conns",
+			Help: "Peer conns with an open data channel.",
+		}, []string{"tracker", "room"}),
+		timeToConnect: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gop2pt_time_to_connect_seconds",
+			Help:    "Time from sending or receiving an offer to the data channel opening, by who offered.",
+			Buckets: timeToConnectBuckets,
+		}, []string{"tracker", "room", "offerer"}),
+		signaling: signalingTracker{
+			started: make(map[signalingKey]time.Time),
+			open:    make(map[signalingKey]bool),
+		},
+	}
+	m.Registry.MustRegister(m.dials, m.announces, m.offersSent, m.offersAnswered, m.offersTimedOut,
+		m.inboundOffers, m.openConns, m.timeToConnect)
+	m.handler = promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+	return m
+}
+
+// ServeHTTP serves every metric of the Registry, for Prometheus to scrape.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.handler.ServeHTTP(w, r)
+}
+
+// OnEvent records e. It is an event.Handler.
+func (m *Metrics) OnEvent(e event.Event) {
+	room := ""
+	if !e.InfoHash.IsZero() {
+		room = e.InfoHash.Hex()
+	}
+	key := signalingKey{tracker: e.Tracker, offerID: e.OfferID, peerID: e.PeerID}
+
+	switch e.Type {
+	case event.TrackerConnected:
+		m.dials.WithLabelValues(e.Tracker, "ok").Inc()
+	case event.TrackerConnectFailed:
+		m.dials.WithLabelValues(e.Tracker, "error").Inc()
+	case event.AnnounceSucceeded:
+		m.announces.WithLabelValues(e.Tracker, room, "ok").Inc()
+	case event.AnnounceFailed:
+		m.announces.WithLabelValues(e.Tracker, room, "error").Inc()
+	case event.OfferSent:
+		m.offersSent.WithLabelValues(e.Tracker, room).Inc()
+		m.signaling.start(signalingKey{tracker: e.Tracker, offerID: e.OfferID}, e.Time)
+	case event.AnswerReceived:
+		m.offersAnswered.WithLabelValues(e.Tracker, room).Inc()
+	case event.OfferTimedOut:
+		m.offersTimedOut.WithLabelValues(e.Tracker, room).Inc()
+		m.signaling.finish(signalingKey{tracker: e.Tracker, offerID: e.OfferID})
+	case event.OfferReceived:
+		m.inboundOffers.WithLabelValues(e.Tracker, room).Inc()
+		m.signaling.start(key, e.Time)
+	case event.AnswerTimedOut, event.SignalingFailed:
+		m.signaling.finish(key)
+		if e.LocalOffered {
+			m.signaling.finish(signalingKey{tracker: e.Tracker, offerID: e.OfferID})
+		}
+	case event.PeerConnected:
+		// Our own offers are sent before we know who answers them.
+		started := key
+		if e.LocalOffered {
+			started.peerID = utils.PeerID{}
+		}
+		if since, ok := m.signaling.finish(started); ok {
+			offerer := "remote"
+			if e.LocalOffered {
+				offerer = "local"
+			}
+			m.timeToConnect.WithLabelValues(e.Tracker, room, offerer).Observe(e.Time.Sub(since).Seconds())
+		}
+		if m.signaling.opened(key) {
+			m.openConns.WithLabelValues(e.Tracker, room).Inc()
+		}
+	case event.PeerDisconnected:
+		if m.signaling.closed(key) {
+			m.openConns.WithLabelValues(e.Tracker, room).Dec()
+		}
+	}
+}
+
+// signalingKey identifies a conn being set up. Our own offers have no peer ID until answered.
+type signalingKey struct {
+	tracker string
+	offerID string
+	peerID  utils.PeerID
+}
+
+// signalingTracker remembers when signaling started, and which conns are open.
+type signalingTracker struct {
+	mu      sync.Mutex
+	started map[signalingKey]time.Time
+	open    map[signalingKey]bool
+}
+
+func (s *signalingTracker) start(key signalingKey, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, since := range s.started {
+		if t.Sub(since) > signalingTimeout {
+			delete(s.started, k)
+		}
+	}
+	s.started[key] = t
+}
+
+func (s *signalingTracker) finish(key signalingKey) (since time.Time, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	since, ok = s.started[key]
+	delete(s.started, key)
+	return
+}
+
+// opened reports whether key wasn't open yet.
+func (s *signalingTracker) opened(key signalingKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.open[key] {
+		return false
+	}
+	s.open[key] = true
+	return true
+}
+
+// closed reports whether key was open.
+func (s *signalingTracker) closed(key signalingKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.open[key] {
+		return false
+	}
+	delete(s.open, key)
+	return true
+}
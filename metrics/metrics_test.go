@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/DaniilSokolyuk/gop2pt/event"
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+func TestMetricsOnEvent(t *testing.T) {
+	m := New()
+	tracker := "wss://tracker.example"
+	infoHash := utils.MakeInfoHash("metrics")
+	room := infoHash.Hex()
+	peerID := utils.PeerID{1}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, e := range []event.Event{
+		{Type: event.TrackerConnectFailed},
+		{Type: event.TrackerConnected},
+		{Type: event.AnnounceSucceeded, InfoHash: infoHash},
+		{Type: event.OfferSent, InfoHash: infoHash, OfferID: "ours", Time: start},
+		{Type: event.AnswerReceived, InfoHash: infoHash, OfferID: "ours", PeerID: peerID},
+		{Type: event.PeerConnected, InfoHash: infoHash, OfferID: "ours", PeerID: peerID, LocalOffered: true, Time: start.Add(300 * time.Millisecond)},
+		{Type: event.OfferReceived, InfoHash: infoHash, OfferID: "theirs", PeerID: peerID, Time: start},
+		{Type: event.PeerConnected, InfoHash: infoHash, OfferID: "theirs", PeerID: peerID, Time: start.Add(2 * time.Second)},
+		{Type: event.PeerDisconnected, InfoHash: infoHash, OfferID: "theirs", PeerID: peerID},
+		{Type: event.OfferSent, InfoHash: infoHash, OfferID: "unanswered", Time: start},
+		{Type: event.OfferTimedOut, InfoHash: infoHash, OfferID: "unanswered"},
+	} {
+		e.Tracker = tracker
+		m.OnEvent(e)
+	}
+
+	for _, tc := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"successful dials", testutil.ToFloat64(m.dials.WithLabelValues(tracker, "ok")), 1},
+		{"failed dials", testutil.ToFloat64(m.dials.WithLabelValues(tracker, "error")), 1},
+		{"announces", testutil.ToFloat64(m.announces.WithLabelValues(tracker, room, "ok")), 1},
+		{"offers sent", testutil.ToFloat64(m.offersSent.WithLabelValues(tracker, room)), 2},
+		{"offers answered", testutil.ToFloat64(m.offersAnswered.WithLabelValues(tracker, room)), 1},
+		{"offers timed out", testutil.ToFloat64(m.offersTimedOut.WithLabelValues(tracker, room)), 1},
+		{"inbound offers", testutil.ToFloat64(m.inboundOffers.WithLabelValues(tracker, room)), 1},
+		// The conn to the peer's offer closed again.
+		{"open conns", testutil.ToFloat64(m.openConns.WithLabelValues(tracker, room)), 1},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+	if n := testutil.CollectAndCount(m.timeToConnect); n != 2 {
+		t.Errorf("time to connect observed for %d offerers, want 2", n)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`gop2pt_time_to_connect_seconds_bucket{offerer="local",room="` + room + `",tracker="` + tracker + `",le="0.5"} 1`,
+		`gop2pt_time_to_connect_seconds_bucket{offerer="remote",room="` + room + `",tracker="` + tracker + `",le="1"} 0`,
+		`gop2pt_time_to_connect_seconds_bucket{offerer="remote",room="` + room + `",tracker="` + tracker + `",le="2.5"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("exposition lacks %s:\n%s", want, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Package netsim builds pion vnet networks for testing peers under NAT, packet loss and latency
+// without touching real interfaces. Pass each of Topology.Nets to gop2pt.WithVNet.
+package netsim
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/vnet"
+	"github.com/pion/turn/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	wanCIDR = "1.2.3.0/24"
+	lanCIDR = "192.168.0.0/24"
+	// The STUN and TURN server, on the WAN.
+	serverIP   = "1.2.3.4"
+	serverPort = 3478
+
+	turnRealm    = "netsim"
+	turnUsername = "netsim"
+	turnPassword = "netsim"
+)
+
+// Config describes the network between peers.
+type Config struct {
+	// The NAT each peer sits behind, on its own LAN. Nil puts peers directly on the WAN.
+	NAT *vnet.NATType
+	// Fraction of packets dropped on the WAN, from 0 to 1.
+	Loss float64
+	// Added to every packet crossing the WAN, so the round trip between two peers is twice that.
+	Delay time.Duration
+	// Random extra delay on top of Delay.
+	Jitter time.Duration
+}
+
+// FullConeNAT puts every peer behind a NAT that maps and filters independently of the remote
+// endpoint. Peers connect directly using STUN.
+func FullConeNAT() Config {
+	return Config{NAT: &vnet.NATType{
+		MappingBehavior:   vnet.EndpointIndependent,
+		FilteringBehavior: vnet.EndpointIndependent,
+	}}
+}
+
+// SymmetricNAT puts every peer behind a NAT that maps and filters by remote address and port.
+// Peers can't connect directly, only through TURN.
+func SymmetricNAT() Config {
+	return Config{NAT: &vnet.NATType{
+		MappingBehavior:   vnet.EndpointAddrPortDependent,
+		FilteringBehavior: vnet.EndpointAddrPortDependent,
+	}}
+}
+
+// LossyLink puts peers directly on a WAN that drops the given fraction of packets.
+func LossyLink(loss float64) Config {
+	return Config{Loss: loss}
+}
+
+// HighRTTLink puts peers directly on a WAN with the given round trip time.
+func HighRTTLink(rtt time.Duration) Config {
+	return Config{Delay: rtt / 2}
+}
+
+// Topology is a running simulated network.
+type Topology struct {
+	// The internet, shared by the NATs, the peers without NAT and the STUN/TURN server.
+	WAN *vnet.Router
+	// One network stack per peer.
+	Nets []*vnet.Net
+	// The STUN server, for server reflexive candidates.
+	STUN webrtc.ICEServer
+	// The TURN server on the same address, for relayed candidates.
+	TURN webrtc.ICEServer
+
+	server *turn.Server
+}
+
+// ICEServers returns the STUN and TURN servers, with the TURN credentials, for
+// gop2pt.WithICEServers.
+func (t *Topology) ICEServers() []webrtc.ICEServer {
+	return []webrtc.ICEServer{t.STUN, t.TURN}
+}
+
+// New starts a network with one Net per peer, laid out as described by config.
+func New(peers int, config Config) (*Topology, error) {
+	loggerFactory := logging.NewDefaultLoggerFactory()
+	loggerFactory.DefaultLogLevel = logging.LogLevelDisabled
+
+	wan, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          wanCIDR,
+		MinDelay:      config.Delay,
+		MaxJitter:     config.Jitter,
+		LoggerFactory: loggerFactory,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if config.Loss > 0 {
+		wan.AddChunkFilter(func(vnet.Chunk) bool {
+			return rand.Float64() >= config.Loss
+		})
+	}
+
+	t := &Topology{WAN: wan}
+	for i := 0; i < peers; i++ {
+		n := vnet.NewNet(&vnet.NetConfig{})
+		if config.NAT == nil {
+			err = wan.AddNet(n)
+		} else {
+			err = addBehindNAT(wan, n, *config.NAT, loggerFactory)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("adding peer %d: %w", i, err)
+		}
+		t.Nets = append(t.Nets, n)
+	}
+
+	serverNet := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{serverIP}})
+	if err := wan.AddNet(serverNet); err != nil {
+		return nil, err
+	}
+	if err := wan.Start(); err != nil {
+		return nil, err
+	}
+	if err := t.startServer(serverNet, loggerFactory); err != nil {
+		wan.Stop()
+		return nil, fmt.Errorf("starting STUN/TURN server: %w", err)
+	}
+	return t, nil
+}
+
+// addBehindNAT creates a LAN for n, connected to wan through a NAT.
+func addBehindNAT(wan *vnet.Router, n *vnet.Net, nat vnet.NATType, loggerFactory logging.LoggerFactory) error {
+	lan, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          lanCIDR,
+		NATType:       &nat,
+		LoggerFactory: loggerFactory,
+	})
+	if err != nil {
+		return err
+	}
+	if err := lan.AddNet(n); err != nil {
+		return err
+	}
+	return wan.AddRouter(lan)
+}
+
+func (t *Topology) startServer(n *vnet.Net, loggerFactory logging.LoggerFactory) error {
+	addr := fmt.Sprintf("%s:%d", serverIP, serverPort)
+	conn, err := n.ListenPacket("udp4", addr)
+	if err != nil {
+		return err
+	}
+	key := turn.GenerateAuthKey(turnUsername, turnRealm, turnPassword)
+	t.server, err = turn.NewServer(turn.ServerConfig{
+		Realm: turnRealm,
+		AuthHandler: func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+			return key, username == turnUsername
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn: conn,
+			RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP(serverIP),
+				Address:      serverIP,
+				Net:          n,
+			},
+		}},
+		LoggerFactory: loggerFactory,
+	})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	t.STUN = webrtc.ICEServer{URLs: []string{"stun:" + addr}}
+	t.TURN = webrtc.ICEServer{
+		URLs:       []string{"turn:" + addr + "?transport=udp"},
+		Username:   turnUsername,
+		Credential: turnPassword,
+	}
+	return nil
+}
+
+// Close stops the STUN/TURN server and the routers.
+func (t *Topology) Close() error {
+	t.server.Close()
+	return t.WAN.Stop()
+}
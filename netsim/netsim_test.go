@@ -0,0 +1,143 @@
+package netsim_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/vnet"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/DaniilSokolyuk/gop2pt"
+	"github.com/DaniilSokolyuk/gop2pt/event"
+	"github.com/DaniilSokolyuk/gop2pt/netsim"
+	"github.com/DaniilSokolyuk/gop2pt/p2pttest"
+)
+
+// connectPair starts two peers on the nets of topology, announcing to a loopback tracker, and
+// reports whether they connect within timeout.
+func connectPair(t *testing.T, topology *netsim.Topology, servers []webrtc.ICEServer, timeout time.Duration, opts ...gop2pt.Option) bool {
+	t.Helper()
+	tracker := p2pttest.NewTracker(t)
+	var peers []*p2pttest.Peer
+	for _, n := range topology.Nets {
+		peerOpts := append([]gop2pt.Option{gop2pt.WithVNet(n), gop2pt.WithICEServers(servers...)}, opts...)
+		peers = append(peers, p2pttest.NewPeer(t, t.Name(), tracker.URL, peerOpts...))
+	}
+	return waitFor(timeout, func() bool { return peers[0].ConnectedTo(peers[1]) && peers[1].ConnectedTo(peers[0]) })
+}
+
+func newTopology(t *testing.T, config netsim.Config) *netsim.Topology {
+	t.Helper()
+	topology, err := netsim.New(2, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { topology.Close() })
+	return topology
+}
+
+func TestNoNAT(t *testing.T) {
+	topology := newTopology(t, netsim.Config{})
+	if !connectPair(t, topology, nil, 30*time.Second) {
+		t.Fatal("peers on the same WAN didn't connect")
+	}
+}
+
+func TestFullConeNAT(t *testing.T) {
+	topology := newTopology(t, netsim.FullConeNAT())
+	if !connectPair(t, topology, []webrtc.ICEServer{topology.STUN}, 30*time.Second) {
+		t.Fatal("peers behind full cone NATs didn't connect with STUN")
+	}
+}
+
+func TestSymmetricNATNeedsTURN(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for ICE to fail")
+	}
+	topology := newTopology(t, netsim.SymmetricNAT())
+	if connectPair(t, topology, []webrtc.ICEServer{topology.STUN}, 10*time.Second) {
+		t.Fatal("peers behind symmetric NATs connected without TURN")
+	}
+}
+
+func TestSymmetricNATRelayOnly(t *testing.T) {
+	topology := newTopology(t, netsim.SymmetricNAT())
+	if !connectPair(t, topology, topology.ICEServers(), 30*time.Second, gop2pt.WithPrivacy(gop2pt.PrivacyRelayOnly)) {
+		t.Fatal("peers behind symmetric NATs didn't connect through TURN")
+	}
+}
+
+func TestSymmetricNATWithTURN(t *testing.T) {
+	topology := newTopology(t, netsim.SymmetricNAT())
+	if !connectPair(t, topology, topology.ICEServers(), 30*time.Second) {
+		t.Fatal("peers behind symmetric NATs didn't connect with the topology's ICE servers")
+	}
+}
+
+// TestReconnectAfterLinkDrop cuts the WAN between two connected peers until their heartbeats
+// fail the conns, then restores it and expects them to reconnect.
+func TestReconnectAfterLinkDrop(t *testing.T) {
+	topology := newTopology(t, netsim.Config{})
+	var down int32
+	topology.WAN.AddChunkFilter(func(vnet.Chunk) bool {
+		return atomic.LoadInt32(&down) == 0
+	})
+
+	tracker := p2pttest.NewTracker(t)
+	newPeer := func(n *vnet.Net, id gop2pt.PeerID) *p2pttest.Peer {
+		return p2pttest.NewPeer(t, t.Name(), tracker.URL,
+			gop2pt.WithVNet(n),
+			gop2pt.WithPeerID(id),
+			gop2pt.WithHeartbeat(50*time.Millisecond, 300*time.Millisecond),
+			gop2pt.WithReconnect(gop2pt.ReconnectConfig{MinBackoff: 100 * time.Millisecond}),
+		)
+	}
+	low := newPeer(topology.Nets[0], gop2pt.PeerID{1})
+	high := newPeer(topology.Nets[1], gop2pt.PeerID{2})
+	if !waitFor(30*time.Second, func() bool { return low.ConnectedTo(high) && high.ConnectedTo(low) }) {
+		t.Fatal("peers didn't connect")
+	}
+
+	reconnected := make(chan event.Event, 10)
+	low.OnEvent(func(e event.Event) {
+		if e.Type == event.PeerReconnected {
+			reconnected <- e
+		}
+	})
+	atomic.StoreInt32(&down, 1)
+	if !waitFor(10*time.Second, func() bool { return !low.ConnectedTo(high) && !high.ConnectedTo(low) }) {
+		t.Fatal("conns survived the link going down")
+	}
+	atomic.StoreInt32(&down, 0)
+
+	select {
+	case e := <-reconnected:
+		if e.PeerID != (gop2pt.PeerID{2}) {
+			t.Fatalf("reconnected to %s, want %s", e.PeerID, gop2pt.PeerID{2})
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("lost peer not reconnected")
+	}
+	if !waitFor(10*time.Second, func() bool {
+		for _, conn := range low.Conns(high) {
+			if conn.Reconnected() {
+				return true
+			}
+		}
+		return false
+	}) {
+		t.Fatal("no conn flagged as a reconnection")
+	}
+}
+
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
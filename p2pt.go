@@ -1,17 +1,24 @@
 package gop2pt
 
 import (
+	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
-	"github.com/pion/datachannel"
+	"github.com/pion/logging"
+	"github.com/pion/transport/vnet"
+	"github.com/pion/webrtc/v3"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/DaniilSokolyuk/gop2pt/event"
+	"github.com/DaniilSokolyuk/gop2pt/identity"
 	dslog "github.com/DaniilSokolyuk/gop2pt/log"
 	"github.com/DaniilSokolyuk/gop2pt/utils"
 	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
@@ -44,12 +51,60 @@ func WithLogger(logger dslog.Logger) Option {
 	}
 }
 
+// WithPionLogLevels routes the logs of pion's ICE, DTLS, SCTP and peer connection packages to the
+// Logger, which otherwise never sees them. scopeLevels sets the level by pion scope, such as "ice"
+// or "dtls", and defaultLevel the level of the other scopes. Trace logs are logged as debug.
+func WithPionLogLevels(defaultLevel logging.LogLevel, scopeLevels map[string]logging.LogLevel) Option {
+	return func(p *P2PT) {
+		p.pionLogs = &dslog.PionLoggerFactory{DefaultLevel: defaultLevel, ScopeLevels: scopeLevels}
+	}
+}
+
 func WithProxy(proxy ProxyFunc) Option {
 	return func(p *P2PT) {
 		p.proxy = proxy
 	}
 }
 
+// WithDisconnectedTimeout fails conns whose peer connection stays disconnected for longer than
+// timeout, instead of waiting for ICE to declare it failed.
+func WithDisconnectedTimeout(timeout time.Duration) Option {
+	return func(p *P2PT) {
+		p.health.DisconnectedTimeout = timeout
+	}
+}
+
+// WithHeartbeat exchanges heartbeats with peers every interval and fails conns that stay silent
+// for longer than timeout. A zero timeout defaults to three intervals. Peers must enable this too.
+// Heartbeats take the data channel ID webtorrent.DefaultHeartbeatChannelID, see
+// WithHeartbeatChannelID.
+func WithHeartbeat(interval, timeout time.Duration) Option {
+	return func(p *P2PT) {
+		p.health.HeartbeatInterval = interval
+		p.health.HeartbeatTimeout = timeout
+	}
+}
+
+// WithHeartbeatChannelID moves heartbeats to the negotiated data channel id, for applications that
+// negotiate their own channels with the default one. Peers must use the same id.
+func WithHeartbeatChannelID(id uint16) Option {
+	return func(p *P2PT) {
+		p.health.HeartbeatChannelID = id
+	}
+}
+
+// SDPPolicy validates and filters offers and answers received from peers.
+type SDPPolicy = webtorrent.SDPPolicy
+
+// WithSDPPolicy checks offers and answers from peers against policy before they are used, for
+// example to refuse connecting to private addresses. Without it, the zero SDPPolicy still limits
+// their size and requires a DTLS fingerprint and a data channel media section.
+func WithSDPPolicy(policy SDPPolicy) Option {
+	return func(p *P2PT) {
+		p.sdpPolicy = &policy
+	}
+}
+
 type defaultLog struct {
 	*log.Logger
 }
@@ -58,20 +113,41 @@ func DefaultLogger() *defaultLog {
 	return &defaultLog{Logger: log.New(os.Stderr, "p2pt ", log.LstdFlags)}
 }
 
-func (l *defaultLog) Error(f string, v ...interface{}) {
-	l.Printf("ERROR: "+f, v...)
+func (l *defaultLog) Error(msg string, keysAndValues ...interface{}) {
+	l.print("ERROR", msg, keysAndValues)
 }
 
-func (l *defaultLog) Warn(f string, v ...interface{}) {
-	l.Printf("WARNING: "+f, v...)
+func (l *defaultLog) Warn(msg string, keysAndValues ...interface{}) {
+	l.print("WARNING", msg, keysAndValues)
 }
 
-func (l *defaultLog) Info(f string, v ...interface{}) {
-	l.Printf("INFO: "+f, v...)
+func (l *defaultLog) Info(msg string, keysAndValues ...interface{}) {
+	l.print("INFO", msg, keysAndValues)
 }
 
-func (l *defaultLog) Debug(f string, v ...interface{}) {
-	l.Printf("DEBUG: "+f, v...)
+func (l *defaultLog) Debug(msg string, keysAndValues ...interface{}) {
+	l.print("DEBUG", msg, keysAndValues)
+}
+
+// print writes msg followed by key=value pairs, quoting values that contain spaces.
+func (l *defaultLog) print(level, msg string, keysAndValues []interface{}) {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteString(": ")
+	b.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		var v interface{} = "!MISSING"
+		if i+1 < len(keysAndValues) {
+			v = keysAndValues[i+1]
+		}
+		value := fmt.Sprint(v)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, value)
+	}
+	l.Print(b.String())
 }
 
 type refCountedWebtorrentTrackerClient struct {
@@ -80,56 +156,132 @@ type refCountedWebtorrentTrackerClient struct {
 }
 
 type P2PT struct {
-	peerIDBinary     string
-	infoHashBinary   string
+	peerID           PeerID
+	peerIDSet        bool
+	peerIDFile       string
+	peerIDPrefix     string
+	infoHash         InfoHash
 	announceURLs     []string
+	tiers            *trackerTiers
 	announceInterval time.Duration
 	numWant          int
+	offerBudget      int
 	logger           dslog.Logger
 	proxy            ProxyFunc
+	health           webtorrent.HealthConfig
+	sdpPolicy        *SDPPolicy
+	privacy          PrivacyMode
+	iceServers       []webrtc.ICEServer
+	transport        *webtorrent.Transport
+	tracer           trace.Tracer
+	messageFraming   bool
+	compression      bool
+	streams          bool
+	capabilities     *Capabilities
+	vnet             *vnet.Net
+	reconnect        *reconnector
+	identity         *identity.Identity
+	requireSignedSDP bool
+	roomSecret       []byte
+	handshakes       []handshake
+	handshakeTimeout time.Duration
+	// Deferred from option handling, returned from Start.
+	err error
+
+	// Keyed by announce URL.
+	dialConfigs       map[string]TrackerDialConfig
+	defaultDialConfig TrackerDialConfig
+
+	// Routes pion's logs to logger. Nil discards them.
+	pionLogs *dslog.PionLoggerFactory
 
 	mu      sync.Mutex
 	clients map[string]*refCountedWebtorrentTrackerClient
+	rooms   map[InfoHash]*Room
+	// The room of New's identifier, returned from Start.
+	defaultRoom *Room
+	closed      bool
+	stopCh      chan struct{}
+
+	handlersMu  sync.Mutex
+	handlers    map[int]event.Handler
+	nextHandler int
 }
 
+// New joins the room identifier, whose info hash is the SHA-1 of identifier.
 func New(identifier string, announceURLs []string, opts ...Option) *P2PT {
+	p2pt := newP2PT(announceURLs, opts)
+	p2pt.infoHash = utils.MakeInfoHash(identifier)
+	if p2pt.roomSecret != nil {
+		p2pt.infoHash = utils.MakeSecretInfoHash(identifier, p2pt.roomSecret)
+	}
+	return p2pt
+}
+
+func newP2PT(announceURLs []string, opts []Option) *P2PT {
 	p2pt := &P2PT{
-		peerIDBinary:     utils.MakePeerID(),
-		infoHashBinary:   utils.MakeInfoHash(identifier),
 		announceURLs:     announceURLs,
 		announceInterval: defaultAnnounceInterval,
 		numWant:          defaultNumWant,
+		handshakeTimeout: defaultHandshakeTimeout,
 		logger:           DefaultLogger(),
 		proxy:            nil,
 
 		clients: make(map[string]*refCountedWebtorrentTrackerClient),
+		rooms:   make(map[InfoHash]*Room),
+		stopCh:  make(chan struct{}),
 	}
 
 	for _, o := range opts {
 		o(p2pt)
 	}
+	p2pt.err = p2pt.resolvePeerID()
+	p2pt.transport = p2pt.newTransport()
+	p2pt.handshakes = p2pt.buildHandshakes()
+	p2pt.OnEvent(p2pt.onRoomEvent)
+	if p2pt.tiers != nil {
+		p2pt.OnEvent(p2pt.onTierEvent)
+	}
+	if p2pt.offerBudget > 0 {
+		p2pt.OnEvent(p2pt.onBudgetEvent)
+	}
+
+	if p2pt.reconnect != nil {
+		p2pt.reconnect.peerID = p2pt.peerID
+		p2pt.reconnect.announce = p2pt.announce
+		p2pt.reconnect.offerTo = p2pt.offerTo
+		p2pt.reconnect.emit = p2pt.emit
+		p2pt.OnEvent(p2pt.reconnect.onEvent)
+	}
 
 	return p2pt
 }
 
+// Start connects to the trackers and announces every room. It returns the room of the info hash
+// New was given, closing which closes the P2PT.
 func (p *P2PT) Start() (net.Listener, error) {
-	listener := &webrtcListener{
-		addr:   webrtcNetAddr{peerIDBinary: p.peerIDBinary},
-		onConn: make(chan *webrtcNetConn),
-		stopCh: make(chan struct{}),
+	if p.err != nil {
+		return nil, p.err
 	}
 
-	for _, url := range p.announceURLs {
-		p.connectTracker(url, func(ch datachannel.ReadWriteCloser, dcc webtorrent.DataChannelContext) {
-			conn := &webrtcNetConn{
-				ReadWriteCloser:    ch,
-				DataChannelContext: dcc,
-			}
-
-			p.logger.Debug("new connection (id: %s, local offered: %t, tracker: %s", conn.RemoteAddr(), dcc.LocalOffered, url)
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	p.defaultRoom = p.rooms[p.infoHash]
+	if p.defaultRoom == nil {
+		p.defaultRoom = newRoom(p, p.infoHash)
+		p.rooms[p.infoHash] = p.defaultRoom
+	}
+	p.mu.Unlock()
 
-			listener.onConn <- conn
-		})
+	if p.tiers != nil {
+		go p.failover()
+	} else {
+		for _, url := range p.announceURLs {
+			p.connectTracker(url)
+		}
 	}
 
 	go func() {
@@ -138,49 +290,143 @@ func (p *P2PT) Start() (net.Listener, error) {
 		for {
 			select {
 			case <-ticker.C:
-				for _, cl := range p.clients {
-					cl.Announce()
-				}
-			case <-listener.stopCh:
+				p.announce()
+			case <-p.stopCh:
 				ticker.Stop()
+				if p.tiers != nil {
+					p.tiers.stop()
+				}
+				if p.reconnect != nil {
+					p.reconnect.stop()
+				}
+				p.mu.Lock()
 				for _, value := range p.clients {
 					value.TrackerClient.Close()
 				}
+				p.mu.Unlock()
 				return
 			}
 		}
 	}()
 
-	return listener, nil
+	return p.defaultRoom, nil
 }
 
-func (p *P2PT) connectTracker(
-	url string,
-	onConn func(ch datachannel.ReadWriteCloser, dcc webtorrent.DataChannelContext)) {
+// Close stops announcing, closes the tracker sockets and the listeners of every room. Conns
+// already accepted stay open.
+func (p *P2PT) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.stopCh)
+	rooms := make([]*Room, 0, len(p.rooms))
+	for _, room := range p.rooms {
+		rooms = append(rooms, room)
+	}
+	p.mu.Unlock()
+
+	for _, room := range rooms {
+		room.listener.Close()
+	}
+	return nil
+}
+
+// announce sends fresh offers to every tracker without waiting for the next interval.
+func (p *P2PT) announce() {
+	if p.offerBudget > 0 {
+		p.spendOfferBudget("")
+	}
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	value, ok := p.clients[url]
-	if !ok {
-		dialer := &websocket.Dialer{Proxy: p.proxy, HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout}
-		value = &refCountedWebtorrentTrackerClient{
-			TrackerClient: webtorrent.TrackerClient{
-				NumWant:  p.numWant,
-				Url:      url,
-				PeerId:   p.peerIDBinary,
-				InfoHash: p.infoHashBinary,
-				OnConn:   onConn,
-				Logger:   p.logger,
-				Dialer:   dialer,
-			},
+	for _, cl := range p.clients {
+		go cl.Announce()
+	}
+}
+
+// offerTo sends an offer addressed to peerID through every tracker.
+func (p *P2PT) offerTo(infoHash InfoHash, peerID PeerID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, cl := range p.clients {
+		go cl.OfferTo(infoHash, peerID)
+	}
+}
+
+func (p *P2PT) connectTracker(url string) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	if value, ok := p.clients[url]; ok {
+		value.refCount++
+		p.mu.Unlock()
+		return
+	}
+	dialConfig := p.dialConfig(url)
+	value := &refCountedWebtorrentTrackerClient{
+		TrackerClient: webtorrent.TrackerClient{
+			NumWant:          p.numWant,
+			Url:              url,
+			PeerId:           p.peerID,
+			Logger:           p.logger,
+			Dialer:           p.newDialer(dialConfig),
+			DialHeader:       dialHeader(url, dialConfig),
+			Health:           p.health,
+			OnEvent:          p.emit,
+			RequireSignedSDP: p.requireSignedSDP,
+			SDPPolicy:        p.sdpPolicy,
+			Transport:        p.transport,
+			Tracer:           p.tracer,
+		},
+	}
+	if p.identity != nil {
+		value.TrackerClient.Signer = p.identity
+	}
+	// Start only sets the client up and runs it in the background, and must precede any Join.
+	value.TrackerClient.Start(func(err error) {
+		if err != nil {
+			p.logger.Error("error running tracker client", dslog.KeyTracker, url, dslog.KeyError, err)
 		}
-		value.TrackerClient.Start(func(err error) {
-			if err != nil {
-				p.logger.Error("error running tracker client for %q: %v", url, err)
-			}
-		})
+	})
+	value.refCount = 1
+	p.clients[url] = value
+
+	// Rooms joined from now on see the client in p.clients and join it themselves, so only the
+	// current ones are joined here, without p.mu as Join may block on the tracker socket.
+	rooms := make(map[InfoHash]*Room, len(p.rooms))
+	for infoHash, room := range p.rooms {
+		rooms[infoHash] = room
+	}
+	p.mu.Unlock()
 
-		value.TrackerClient.Announce()
+	for infoHash, room := range rooms {
+		if err := value.TrackerClient.Join(infoHash, p.roomOnConn(room, url)); err != nil {
+			p.logger.Error("error joining room", dslog.KeyTracker, url, dslog.KeyInfoHash, infoHash.Hex(), dslog.KeyError, err)
+		}
+	}
+}
 
-		p.clients[url] = value
+// releaseTracker drops a reference to the client for url, and stops it gracefully once unused.
+func (p *P2PT) releaseTracker(url string) bool {
+	p.mu.Lock()
+	value, ok := p.clients[url]
+	if !ok {
+		p.mu.Unlock()
+		return false
+	}
+	value.refCount--
+	if value.refCount > 0 {
+		p.mu.Unlock()
+		return true
+	}
+	delete(p.clients, url)
+	p.mu.Unlock()
+	if err := value.TrackerClient.Stop(); err != nil {
+		p.logger.Debug("error stopping tracker client", dslog.KeyTracker, url, dslog.KeyError, err)
 	}
+	return true
 }
@@ -0,0 +1,330 @@
+// Package p2pttest runs gop2pt peers against an in-process tracker on loopback, for tests of code
+// built on gop2pt that shouldn't depend on public trackers.
+package p2pttest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DaniilSokolyuk/gop2pt"
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent/server"
+)
+
+const (
+	// Peers in a Mesh announce this often, so that a mesh forms in a few seconds.
+	announceInterval = time.Second
+	leakTimeout      = 10 * time.Second
+	probeTimeout     = 5 * time.Second
+)
+
+var probePrefix = []byte("p2pttest probe ")
+
+// Tracker is a WebTorrent tracker listening on loopback.
+type Tracker struct {
+	*server.Server
+	// The ws:// URL to announce to.
+	URL string
+
+	http *httptest.Server
+}
+
+// NewTracker starts a tracker that is closed when the test finishes.
+func NewTracker(tb testing.TB) *Tracker {
+	tb.Helper()
+	srv := &server.Server{Interval: announceInterval}
+	t := &Tracker{
+		Server: srv,
+		http:   httptest.NewServer(srv),
+	}
+	t.URL = "ws" + strings.TrimPrefix(t.http.URL, "http")
+	tb.Cleanup(t.Close)
+	return t
+}
+
+func (t *Tracker) Close() {
+	t.Server.Close()
+	t.http.Close()
+}
+
+// Message is a message received by a Peer.
+type Message struct {
+	// The Addr of the sending peer.
+	From string
+	Data []byte
+}
+
+// Peer is a started P2PT. It accepts every conn itself and reads messages from them into
+// Messages, which lets it track which peers it is connected to.
+type Peer struct {
+	*gop2pt.P2PT
+	// Identifies the peer, as returned by RemoteAddr on the conns of other peers.
+	Addr string
+	// Messages received from any conn. Messages are dropped while the channel is full.
+	Messages chan Message
+
+	listener  net.Listener
+	mu        sync.Mutex
+	conns     map[string][]gop2pt.Conn // by remote Addr
+	closeOnce sync.Once
+}
+
+// NewPeer starts a P2PT for identifier that announces to trackerURL. It is closed when the test
+// finishes.
+func NewPeer(tb testing.TB, identifier, trackerURL string, opts ...gop2pt.Option) *Peer {
+	tb.Helper()
+	opts = append([]gop2pt.Option{gop2pt.AnnounceInterval(announceInterval)}, opts...)
+	p2pt := gop2pt.New(identifier, []string{trackerURL}, opts...)
+	listener, err := p2pt.Start()
+	if err != nil {
+		tb.Fatalf("starting peer: %v", err)
+	}
+	p := &Peer{
+		P2PT:     p2pt,
+		Addr:     listener.Addr().String(),
+		Messages: make(chan Message, 100),
+		listener: listener,
+		conns:    make(map[string][]gop2pt.Conn),
+	}
+	go p.acceptLoop()
+	tb.Cleanup(p.Close)
+	return p
+}
+
+func (p *Peer) acceptLoop() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := conn.(gop2pt.Conn)
+		remote := c.RemoteAddr().String()
+		p.mu.Lock()
+		p.conns[remote] = append(p.conns[remote], c)
+		p.mu.Unlock()
+		go p.readLoop(remote, c)
+	}
+}
+
+func (p *Peer) readLoop(remote string, c gop2pt.Conn) {
+	defer p.removeConn(remote, c)
+	for {
+		data, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		select {
+		case p.Messages <- Message{From: remote, Data: data}:
+		default:
+		}
+	}
+}
+
+func (p *Peer) removeConn(remote string, c gop2pt.Conn) {
+	c.Close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conns := p.conns[remote]
+	for i := range conns {
+		if conns[i] == c {
+			p.conns[remote] = append(conns[:i:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(p.conns[remote]) == 0 {
+		delete(p.conns, remote)
+	}
+}
+
+// Conn returns an open conn to other, or nil. Peers that offer to each other at the same time may
+// end up with more than one.
+func (p *Peer) Conn(other *Peer) gop2pt.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if conns := p.conns[other.Addr]; len(conns) > 0 {
+		return conns[0]
+	}
+	return nil
+}
+
+// Conns returns the open conns to other.
+func (p *Peer) Conns(other *Peer) []gop2pt.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]gop2pt.Conn(nil), p.conns[other.Addr]...)
+}
+
+// ConnectedTo reports whether p has an open conn to other.
+func (p *Peer) ConnectedTo(other *Peer) bool {
+	return p.Conn(other) != nil
+}
+
+// Send writes data to other as a single message.
+func (p *Peer) Send(other *Peer, data []byte) error {
+	conn := p.Conn(other)
+	if conn == nil {
+		return fmt.Errorf("%s is not connected to %s", p.Addr, other.Addr)
+	}
+	return conn.WriteMessage(data)
+}
+
+// Close stops announcing and closes every conn.
+func (p *Peer) Close() {
+	p.closeOnce.Do(func() {
+		p.listener.Close()
+		p.mu.Lock()
+		var conns []gop2pt.Conn
+		for _, cs := range p.conns {
+			conns = append(conns, cs...)
+		}
+		p.mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	})
+}
+
+// Mesh is a group of peers in the same room on a private tracker.
+type Mesh struct {
+	Tracker *Tracker
+	Peers   []*Peer
+
+	tb         testing.TB
+	identifier string
+	opts       []gop2pt.Option
+}
+
+// NewMesh starts a tracker and n peers announcing to it, each created with opts. It doesn't wait
+// for them to connect, see WaitFullMesh.
+func NewMesh(tb testing.TB, n int, opts ...gop2pt.Option) *Mesh {
+	tb.Helper()
+	m := &Mesh{
+		Tracker:    NewTracker(tb),
+		tb:         tb,
+		identifier: "p2pttest " + tb.Name(),
+		opts:       opts,
+	}
+	for i := 0; i < n; i++ {
+		m.AddPeer()
+	}
+	return m
+}
+
+// AddPeer starts another peer in the mesh, created with the mesh's options followed by opts.
+func (m *Mesh) AddPeer(opts ...gop2pt.Option) *Peer {
+	m.tb.Helper()
+	opts = append(append([]gop2pt.Option(nil), m.opts...), opts...)
+	p := NewPeer(m.tb, m.identifier, m.Tracker.URL, opts...)
+	m.Peers = append(m.Peers, p)
+	return p
+}
+
+// Drop closes p and removes it from the mesh.
+func (m *Mesh) Drop(p *Peer) {
+	p.Close()
+	for i := range m.Peers {
+		if m.Peers[i] == p {
+			m.Peers = append(m.Peers[:i], m.Peers[i+1:]...)
+			break
+		}
+	}
+}
+
+// FullMesh reports whether every peer is connected to every other peer.
+func (m *Mesh) FullMesh() bool {
+	for _, a := range m.Peers {
+		for _, b := range m.Peers {
+			if a != b && !a.ConnectedTo(b) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// WaitFullMesh waits until every peer is connected to every other peer.
+func (m *Mesh) WaitFullMesh(timeout time.Duration) error {
+	if !waitFor(timeout, m.FullMesh) {
+		return errors.New("timed out waiting for a full mesh")
+	}
+	return nil
+}
+
+// RequireFullMesh fails the test now if no full mesh forms within timeout.
+func (m *Mesh) RequireFullMesh(timeout time.Duration) {
+	m.tb.Helper()
+	if err := m.WaitFullMesh(timeout); err != nil {
+		m.tb.Fatal(err)
+	}
+}
+
+// AssertConnected checks that a and b can exchange messages in both directions. It consumes
+// messages from both peers' Messages while it waits.
+func (m *Mesh) AssertConnected(a, b *Peer) {
+	m.tb.Helper()
+	for _, pair := range [][2]*Peer{{a, b}, {b, a}} {
+		if err := probe(pair[0], pair[1]); err != nil {
+			m.tb.Errorf("%s -> %s: %v", pair[0].Addr, pair[1].Addr, err)
+		}
+	}
+}
+
+// AssertDisconnected checks that neither a nor b still has a conn to the other after timeout.
+func (m *Mesh) AssertDisconnected(a, b *Peer, timeout time.Duration) {
+	m.tb.Helper()
+	if !waitFor(timeout, func() bool { return !a.ConnectedTo(b) && !b.ConnectedTo(a) }) {
+		m.tb.Errorf("%s and %s are still connected", a.Addr, b.Addr)
+	}
+}
+
+func probe(from, to *Peer) error {
+	nonce := append(append([]byte(nil), probePrefix...), from.Addr...)
+	if err := from.Send(to, nonce); err != nil {
+		return err
+	}
+	deadline := time.After(probeTimeout)
+	for {
+		select {
+		case msg := <-to.Messages:
+			if msg.From == from.Addr && bytes.Equal(msg.Data, nonce) {
+				return nil
+			}
+		case <-deadline:
+			return errors.New("probe not received")
+		}
+	}
+}
+
+// CheckLeaks records the number of open peer connections and, when the test finishes, fails it if
+// they don't return to that number. Call it before creating peers, so that it runs after they are
+// closed. Peer connections are counted process wide, so it is unreliable in parallel tests.
+func CheckLeaks(tb testing.TB) {
+	tb.Helper()
+	baseline := webtorrent.OpenPeerConnections()
+	tb.Cleanup(func() {
+		ok := waitFor(leakTimeout, func() bool {
+			return webtorrent.OpenPeerConnections() <= baseline
+		})
+		if !ok {
+			tb.Errorf("%d peer connections leaked", webtorrent.OpenPeerConnections()-baseline)
+		}
+	})
+}
+
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return true
+}
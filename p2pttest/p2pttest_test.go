@@ -0,0 +1,82 @@
+package p2pttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DaniilSokolyuk/gop2pt"
+)
+
+// TestMesh runs peers against the embedded tracker server end to end: they find each other
+// through it, connect over loopback, and notice when one of them goes away.
+func TestMesh(t *testing.T) {
+	CheckLeaks(t)
+	m := NewMesh(t, 3)
+	m.RequireFullMesh(30 * time.Second)
+	m.AssertConnected(m.Peers[0], m.Peers[2])
+
+	gone := m.Peers[1]
+	m.Drop(gone)
+	for _, p := range m.Peers {
+		m.AssertDisconnected(p, gone, 20*time.Second)
+	}
+	m.AssertConnected(m.Peers[0], m.Peers[1])
+}
+
+func TestRoomsAreSeparate(t *testing.T) {
+	tracker := NewTracker(t)
+	a := NewPeer(t, "room a", tracker.URL)
+	b := NewPeer(t, "room a", tracker.URL)
+	other := NewPeer(t, "room b", tracker.URL)
+
+	if !waitFor(30*time.Second, func() bool { return a.ConnectedTo(b) && b.ConnectedTo(a) }) {
+		t.Fatal("peers in the same room didn't connect")
+	}
+	if other.ConnectedTo(a) || other.ConnectedTo(b) {
+		t.Fatal("peer connected to another room")
+	}
+}
+
+// TestStreams opens a stream on a conn and exchanges data on it next to the conn itself.
+func TestStreams(t *testing.T) {
+	tracker := NewTracker(t)
+	a := NewPeer(t, t.Name(), tracker.URL, gop2pt.WithStreams(), gop2pt.WithCompression())
+	b := NewPeer(t, t.Name(), tracker.URL, gop2pt.WithStreams(), gop2pt.WithCompression())
+	if !waitFor(30*time.Second, func() bool { return a.ConnectedTo(b) && b.ConnectedTo(a) }) {
+		t.Fatal("peers didn't connect")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := a.Conn(b).OpenStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if err := stream.WriteMessage([]byte("over the stream")); err != nil {
+		t.Fatal(err)
+	}
+
+	accepted := make(chan gop2pt.Conn, len(b.Conns(a)))
+	for _, conn := range b.Conns(a) {
+		go func(conn gop2pt.Conn) {
+			if s, err := conn.AcceptStream(); err == nil {
+				accepted <- s
+			}
+		}(conn)
+	}
+	select {
+	case s := <-accepted:
+		defer s.Close()
+		msg, err := s.ReadMessage()
+		if err != nil || string(msg) != "over the stream" {
+			t.Fatalf("read %q, %v from the stream", msg, err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("stream not accepted")
+	}
+	if err := a.Send(b, []byte("over the conn")); err != nil {
+		t.Fatalf("conn unusable next to a stream: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package gop2pt
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+// PeerID identifies a peer. Conn addresses are its base58 encoding.
+type PeerID = utils.PeerID
+
+// InfoHash identifies the swarm of a room.
+type InfoHash = utils.InfoHash
+
+// ParsePeerID parses a peer ID in hex, base32 or base58.
+func ParsePeerID(s string) (PeerID, error) {
+	return utils.ParsePeerID(s)
+}
+
+// ParseInfoHash parses an info hash in hex, base32 or base58.
+func ParseInfoHash(s string) (InfoHash, error) {
+	return utils.ParseInfoHash(s)
+}
+
+// ClientPrefix is the BitTorrent-style client prefix identifying gop2pt peers to trackers and
+// other clients. Pass it to WithPeerIDPrefix to use it.
+const ClientPrefix = "-GP0001-"
+
+// WithPeerID uses peerID instead of a random peer ID, keeping it stable across restarts.
+func WithPeerID(peerID PeerID) Option {
+	return func(p *P2PT) {
+		p.peerID = peerID
+		p.peerIDSet = true
+	}
+}
+
+// WithPeerIDFile loads the peer ID from path, or generates one and saves it there if the file
+// doesn't exist yet. The file holds the hex encoded ID. Errors are returned from Start.
+func WithPeerIDFile(path string) Option {
+	return func(p *P2PT) {
+		p.peerIDFile = path
+	}
+}
+
+// WithPeerIDPrefix starts generated peer IDs with prefix, for example ClientPrefix.
+func WithPeerIDPrefix(prefix string) Option {
+	return func(p *P2PT) {
+		p.peerIDPrefix = prefix
+	}
+}
+
+// resolvePeerID settles the peer ID once all options have been applied.
+func (p *P2PT) resolvePeerID() error {
+	if len(p.peerIDPrefix) > 20 {
+		return fmt.Errorf("peer ID prefix %q longer than 20 bytes", p.peerIDPrefix)
+	}
+	if p.identity != nil {
+		p.peerID = p.identity.PeerID()
+		return nil
+	}
+	if p.peerIDSet {
+		return nil
+	}
+	if p.peerIDFile == "" {
+		p.peerID = utils.MakePeerIDWithPrefix(p.peerIDPrefix)
+		return nil
+	}
+
+	peerID, err := loadPeerID(p.peerIDFile)
+	if errors.Is(err, os.ErrNotExist) {
+		p.peerID = utils.MakePeerIDWithPrefix(p.peerIDPrefix)
+		return savePeerID(p.peerIDFile, p.peerID)
+	}
+	if err != nil {
+		return err
+	}
+	p.peerID = peerID
+	return nil
+}
+
+func loadPeerID(path string) (peerID PeerID, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	b, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return peerID, fmt.Errorf("decoding peer ID from %q: %w", path, err)
+	}
+	if len(b) != len(peerID) {
+		return peerID, fmt.Errorf("peer ID in %q is %d bytes, want 20", path, len(b))
+	}
+	copy(peerID[:], b)
+	return
+}
+
+func savePeerID(path string, peerID PeerID) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating peer ID directory: %w", err)
+	}
+	data := peerID.Hex() + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		return fmt.Errorf("saving peer ID: %w", err)
+	}
+	return nil
+}
+
+// PeerID returns the peer ID we announce with.
+func (p *P2PT) PeerID() PeerID {
+	return p.peerID
+}
+
+// InfoHash returns the info hash of the swarm we join.
+func (p *P2PT) InfoHash() InfoHash {
+	return p.infoHash
+}
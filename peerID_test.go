@@ -0,0 +1,147 @@
+package gop2pt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPeerIDOptions(t *testing.T) {
+	fixed := PeerID{1, 2, 3}
+	for _, tc := range []struct {
+		name string
+		// Written to the peer ID file before New, unless empty.
+		file    string
+		opts    func(path string) []Option
+		wantErr string
+		check   func(t *testing.T, id PeerID)
+	}{
+		{
+			name: "fixed",
+			opts: func(string) []Option { return []Option{WithPeerID(fixed)} },
+			check: func(t *testing.T, id PeerID) {
+				if id != fixed {
+					t.Errorf("peer ID %x, want %x", id, fixed)
+				}
+			},
+		},
+		{
+			name: "fixed wins over file and prefix",
+			file: strings.Repeat("ab", 20),
+			opts: func(path string) []Option {
+				return []Option{WithPeerIDFile(path), WithPeerIDPrefix(ClientPrefix), WithPeerID(fixed)}
+			},
+			check: func(t *testing.T, id PeerID) {
+				if id != fixed {
+					t.Errorf("peer ID %x, want %x", id, fixed)
+				}
+			},
+		},
+		{
+			name: "prefix",
+			opts: func(string) []Option { return []Option{WithPeerIDPrefix(ClientPrefix)} },
+			check: func(t *testing.T, id PeerID) {
+				if !strings.HasPrefix(string(id[:]), ClientPrefix) {
+					t.Errorf("peer ID %q doesn't start with %q", id[:], ClientPrefix)
+				}
+			},
+		},
+		{
+			name: "prefix of 20 bytes",
+			opts: func(string) []Option { return []Option{WithPeerIDPrefix(strings.Repeat("x", 20))} },
+			check: func(t *testing.T, id PeerID) {
+				if string(id[:]) != strings.Repeat("x", 20) {
+					t.Errorf("peer ID %q, want the prefix", id[:])
+				}
+			},
+		},
+		{
+			name:    "prefix longer than 20 bytes",
+			opts:    func(string) []Option { return []Option{WithPeerIDPrefix(strings.Repeat("x", 21))} },
+			wantErr: "longer than 20 bytes",
+		},
+		{
+			name:    "prefix longer than 20 bytes with fixed ID",
+			opts:    func(string) []Option { return []Option{WithPeerID(fixed), WithPeerIDPrefix(strings.Repeat("x", 21))} },
+			wantErr: "longer than 20 bytes",
+		},
+		{
+			name: "file",
+			file: " " + fixed.Hex() + "\n",
+			opts: func(path string) []Option { return []Option{WithPeerIDFile(path), WithPeerIDPrefix(ClientPrefix)} },
+			check: func(t *testing.T, id PeerID) {
+				if id != fixed {
+					t.Errorf("peer ID %x, want %x from the file", id, fixed)
+				}
+			},
+		},
+		{
+			name:    "file with bad hex",
+			file:    "zz" + fixed.Hex()[2:],
+			opts:    func(path string) []Option { return []Option{WithPeerIDFile(path)} },
+			wantErr: "decoding peer ID",
+		},
+		{
+			name:    "file with short ID",
+			file:    fixed.Hex()[:38],
+			opts:    func(path string) []Option { return []Option{WithPeerIDFile(path)} },
+			wantErr: "is 19 bytes, want 20",
+		},
+		{
+			name:    "file with long ID",
+			file:    fixed.Hex() + "00",
+			opts:    func(path string) []Option { return []Option{WithPeerIDFile(path)} },
+			wantErr: "is 21 bytes, want 20",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "peer-id")
+			if tc.file != "" {
+				if err := os.WriteFile(path, []byte(tc.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			p := New(t.Name(), nil, tc.opts(path)...)
+			if tc.wantErr != "" {
+				if p.err == nil || !strings.Contains(p.err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", p.err, tc.wantErr)
+				}
+				if _, err := p.Start(); err != p.err {
+					t.Fatalf("Start returned %v, want %v", err, p.err)
+				}
+				return
+			}
+			if p.err != nil {
+				t.Fatal(p.err)
+			}
+			tc.check(t, p.PeerID())
+		})
+	}
+}
+
+func TestPeerIDFileCreated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dir", "peer-id")
+	first := New(t.Name(), nil, WithPeerIDFile(path), WithPeerIDPrefix(ClientPrefix))
+	if first.err != nil {
+		t.Fatal(first.err)
+	}
+	if id := first.PeerID(); !strings.HasPrefix(string(id[:]), ClientPrefix) {
+		t.Fatalf("generated peer ID %q doesn't start with %q", id[:], ClientPrefix)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != first.PeerID().Hex() {
+		t.Fatalf("file holds %q, want %q", got, first.PeerID().Hex())
+	}
+
+	second := New(t.Name(), nil, WithPeerIDFile(path))
+	if second.err != nil {
+		t.Fatal(second.err)
+	}
+	if second.PeerID() != first.PeerID() {
+		t.Fatalf("reloaded peer ID %x, want %x", second.PeerID(), first.PeerID())
+	}
+}
@@ -0,0 +1,59 @@
+package gop2pt
+
+import (
+	"github.com/pion/transport/vnet"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
+)
+
+// PrivacyMode selects which of our addresses offers and answers may expose.
+type PrivacyMode = webtorrent.PrivacyMode
+
+const (
+	PrivacyOff       = webtorrent.PrivacyOff
+	PrivacyMDNS      = webtorrent.PrivacyMDNS
+	PrivacySrflxOnly = webtorrent.PrivacySrflxOnly
+	PrivacyRelayOnly = webtorrent.PrivacyRelayOnly
+)
+
+// WithPrivacy keeps local IP addresses out of the offers and answers we send. Descriptions that
+// would still expose a private address are not sent. PrivacySrflxOnly needs STUN and
+// PrivacyRelayOnly needs TURN servers, see WithICEServers.
+func WithPrivacy(mode PrivacyMode) Option {
+	return func(p *P2PT) {
+		p.privacy = mode
+	}
+}
+
+// WithICEServers sets the STUN and TURN servers used to gather candidates.
+func WithICEServers(servers ...webrtc.ICEServer) Option {
+	return func(p *P2PT) {
+		p.iceServers = servers
+	}
+}
+
+// WithVNet sends all peer connection traffic over n, a pion simulated network, instead of the real
+// interfaces. Trackers are still dialed over the real network. See the netsim package for ready
+// made topologies.
+func WithVNet(n *vnet.Net) Option {
+	return func(p *P2PT) {
+		p.vnet = n
+	}
+}
+
+func (p *P2PT) newTransport() *webtorrent.Transport {
+	config := webrtc.Configuration{ICEServers: p.iceServers}
+	if config.ICEServers == nil {
+		config.ICEServers = []webrtc.ICEServer{}
+	}
+	s := webtorrent.NewSettingEngine()
+	if p.vnet != nil {
+		webtorrent.SetVNet(&s, p.vnet)
+	}
+	if p.pionLogs != nil {
+		p.pionLogs.Logger = p.logger
+		webtorrent.SetLoggerFactory(&s, p.pionLogs)
+	}
+	return webtorrent.NewTransport(s, config, p.privacy)
+}
@@ -0,0 +1,150 @@
+package gop2pt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DaniilSokolyuk/gop2pt/event"
+)
+
+var (
+	defaultReconnectWindow     = time.Minute * 5
+	defaultReconnectMinBackoff = time.Second * 5
+	defaultReconnectMaxBackoff = time.Minute
+)
+
+// ReconnectConfig controls how hard P2PT tries to get back peers whose connection failed.
+//
+// Of the two peers, the one with the lower peer ID sends offers addressed to the other, see
+// webtorrent.TrackerClient.OfferTo, so that they don't connect twice. Only webtorrent/server
+// delivers such offers to the addressed peer. Other WebTorrent trackers pair offers with random
+// peers, so there reconnecting amounts to announcing fresh offers more often until the tracker
+// pairs us with the lost peer again. The peer with the higher ID does just that.
+type ReconnectConfig struct {
+	// How long after losing a peer to keep trying. Defaults to five minutes.
+	Window time.Duration
+	// Delay before the first extra announce, doubled after every attempt. Defaults to 5 seconds.
+	MinBackoff time.Duration
+	// Upper bound for the delay between attempts. Defaults to one minute.
+	MaxBackoff time.Duration
+}
+
+// WithReconnect remembers peers whose connection failed and actively tries to reconnect to them.
+// Conns that re-establish such a peer are delivered through Accept with Reconnected reporting
+// true, and an event.PeerReconnected event is emitted.
+func WithReconnect(config ReconnectConfig) Option {
+	return func(p *P2PT) {
+		if config.Window <= 0 {
+			config.Window = defaultReconnectWindow
+		}
+		if config.MinBackoff <= 0 {
+			config.MinBackoff = defaultReconnectMinBackoff
+		}
+		if config.MaxBackoff < config.MinBackoff {
+			config.MaxBackoff = defaultReconnectMaxBackoff
+		}
+		p.reconnect = &reconnector{
+			config: config,
+			lost:   make(map[PeerID]*lostPeer),
+		}
+	}
+}
+
+type lostPeer struct {
+	// The swarm the peer was lost from.
+	infoHash InfoHash
+	since    time.Time
+	backoff  time.Duration
+	timer    *time.Timer
+}
+
+type reconnector struct {
+	config ReconnectConfig
+	// Our own peer ID, to decide which side offers.
+	peerID   PeerID
+	announce func()
+	offerTo  func(InfoHash, PeerID)
+	emit     func(event.Event)
+
+	mu            sync.Mutex
+	lost          map[PeerID]*lostPeer
+	lastAnnounced time.Time
+	stopped       bool
+}
+
+// onEvent tracks peers whose connection ended with an error.
+func (r *reconnector) onEvent(e event.Event) {
+	if e.Type != event.PeerDisconnected || e.Err == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return
+	}
+	if _, ok := r.lost[e.PeerID]; ok {
+		// Another conn to the same peer already failed.
+		return
+	}
+	lp := &lostPeer{infoHash: e.InfoHash, since: time.Now(), backoff: r.config.MinBackoff}
+	lp.timer = time.AfterFunc(lp.backoff, func() { r.attempt(e.PeerID, lp) })
+	r.lost[e.PeerID] = lp
+}
+
+func (r *reconnector) attempt(peerID PeerID, lp *lostPeer) {
+	r.mu.Lock()
+	if r.stopped || r.lost[peerID] != lp {
+		r.mu.Unlock()
+		return
+	}
+	if time.Since(lp.since) > r.config.Window {
+		delete(r.lost, peerID)
+		r.mu.Unlock()
+		r.emit(event.Event{Type: event.PeerReconnectAbandoned, PeerID: peerID})
+		return
+	}
+	direct := r.peerID.Compare(peerID) < 0
+	// Several lost peers share the same announces, so don't flood the trackers.
+	announce := !direct && time.Since(r.lastAnnounced) >= r.config.MinBackoff
+	if announce {
+		r.lastAnnounced = time.Now()
+	}
+	lp.backoff *= 2
+	if lp.backoff > r.config.MaxBackoff {
+		lp.backoff = r.config.MaxBackoff
+	}
+	lp.timer.Reset(lp.backoff)
+	r.mu.Unlock()
+
+	if direct {
+		r.offerTo(lp.infoHash, peerID)
+	} else if announce {
+		r.announce()
+	}
+}
+
+// reconnected reports whether peerID was lost recently, and forgets it.
+func (r *reconnector) reconnected(peerID PeerID) bool {
+	r.mu.Lock()
+	lp, ok := r.lost[peerID]
+	if ok {
+		lp.timer.Stop()
+		delete(r.lost, peerID)
+	}
+	r.mu.Unlock()
+
+	if ok {
+		r.emit(event.Event{Type: event.PeerReconnected, PeerID: peerID})
+	}
+	return ok
+}
+
+func (r *reconnector) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+	for id, lp := range r.lost {
+		lp.timer.Stop()
+		delete(r.lost, id)
+	}
+}
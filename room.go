@@ -0,0 +1,202 @@
+package gop2pt
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/pion/datachannel"
+
+	"github.com/DaniilSokolyuk/gop2pt/event"
+	dslog "github.com/DaniilSokolyuk/gop2pt/log"
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
+)
+
+var ErrAlreadyJoined = errors.New("room already joined")
+
+// Room is a swarm joined by a P2PT. It is a net.Listener whose Accept returns conns to peers in
+// that swarm only. All rooms of a P2PT share its peer ID, WebRTC settings and tracker sockets.
+type Room struct {
+	p        *P2PT
+	infoHash InfoHash
+	listener *webrtcListener
+
+	mu    sync.Mutex
+	conns map[*webrtcNetConn]struct{}
+	left  bool
+}
+
+func newRoom(p *P2PT, infoHash InfoHash) *Room {
+	return &Room{
+		p:        p,
+		infoHash: infoHash,
+		listener: &webrtcListener{
+			addr:   webrtcNetAddr{peerID: p.peerID},
+			onConn: make(chan *webrtcNetConn),
+			stopCh: make(chan struct{}),
+		},
+		conns: make(map[*webrtcNetConn]struct{}),
+	}
+}
+
+// Join joins the room identifier too, with the same info hash New would derive for it. Rooms
+// joined before Start are announced from Start.
+func (p *P2PT) Join(identifier string) (*Room, error) {
+	infoHash := utils.MakeInfoHash(identifier)
+	if p.roomSecret != nil {
+		infoHash = utils.MakeSecretInfoHash(identifier, p.roomSecret)
+	}
+	return p.JoinInfoHash(infoHash)
+}
+
+// JoinInfoHash joins the swarm of infoHash too.
+func (p *P2PT) JoinInfoHash(infoHash InfoHash) (*Room, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	if _, ok := p.rooms[infoHash]; ok {
+		p.mu.Unlock()
+		return nil, ErrAlreadyJoined
+	}
+	room := newRoom(p, infoHash)
+	p.rooms[infoHash] = room
+	// Join announces, which may block on the tracker socket, so it runs without p.mu. Clients
+	// added meanwhile join the room themselves, see connectTracker.
+	clients := make(map[string]*refCountedWebtorrentTrackerClient, len(p.clients))
+	for url, cl := range p.clients {
+		clients[url] = cl
+	}
+	p.mu.Unlock()
+
+	for url, cl := range clients {
+		if err := cl.Join(infoHash, p.roomOnConn(room, url)); err != nil {
+			p.logger.Error("error joining room", dslog.KeyTracker, url, dslog.KeyInfoHash, infoHash.Hex(), dslog.KeyError, err)
+		}
+	}
+	return room, nil
+}
+
+// roomOnConn turns data channels opened in room's swarm into conns for its Accept.
+func (p *P2PT) roomOnConn(room *Room, url string) func(datachannel.ReadWriteCloser, webtorrent.DataChannelContext) {
+	return func(ch datachannel.ReadWriteCloser, dcc webtorrent.DataChannelContext) {
+		conn := &webrtcNetConn{
+			ReadWriteCloser:    ch,
+			DataChannelContext: dcc,
+			chunkSize:          writeChunkSize(dcc),
+		}
+		p.logger.Debug("new connection", dslog.KeyTracker, url, dslog.KeyInfoHash, room.infoHash.Hex(), dslog.KeyPeerID, dcc.PeerID.String(), dslog.KeyOfferID, dslog.OfferID(dcc.OfferId), "local_offered", dcc.LocalOffered)
+
+		go p.admit(conn, func(conn *webrtcNetConn) {
+			// Only a peer that passed the handshakes counts as reconnected.
+			if p.reconnect != nil {
+				conn.reconnected = p.reconnect.reconnected(conn.PeerID)
+			}
+			conn.startStreams()
+			room.deliver(conn)
+		})
+	}
+}
+
+// onRoomEvent forgets conns whose peer connection closed.
+func (p *P2PT) onRoomEvent(e event.Event) {
+	if e.Type != event.PeerDisconnected {
+		return
+	}
+	p.mu.Lock()
+	room := p.rooms[e.InfoHash]
+	p.mu.Unlock()
+	if room == nil {
+		return
+	}
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	for conn := range room.conns {
+		if conn.PeerID == e.PeerID && conn.OfferId == e.OfferID {
+			delete(room.conns, conn)
+		}
+	}
+}
+
+func (r *Room) deliver(conn *webrtcNetConn) {
+	r.mu.Lock()
+	if r.left {
+		r.mu.Unlock()
+		conn.Close()
+		return
+	}
+	r.conns[conn] = struct{}{}
+	r.mu.Unlock()
+	r.listener.deliver(conn)
+}
+
+// InfoHash returns the info hash of the room's swarm.
+func (r *Room) InfoHash() InfoHash {
+	return r.infoHash
+}
+
+// Peers returns the peers with an open conn in the room.
+func (r *Room) Peers() []PeerID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := make(map[PeerID]bool, len(r.conns))
+	var peers []PeerID
+	for conn := range r.conns {
+		if !seen[conn.PeerID] {
+			seen[conn.PeerID] = true
+			peers = append(peers, conn.PeerID)
+		}
+	}
+	return peers
+}
+
+func (r *Room) Accept() (net.Conn, error) {
+	return r.listener.Accept()
+}
+
+func (r *Room) Addr() net.Addr {
+	return r.listener.Addr()
+}
+
+// Close leaves the room and closes its conns, like Leave. Closing the room returned from Start
+// shuts down the whole P2PT as well, see P2PT.Close, like closing its listener always did.
+func (r *Room) Close() error {
+	if r == r.p.defaultRoom {
+		err := r.p.Close()
+		r.closeConns()
+		return err
+	}
+	return r.Leave()
+}
+
+// Leave stops announcing to the room's swarm, tells the trackers so and closes the room's conns.
+// Other rooms are unaffected.
+func (r *Room) Leave() error {
+	r.p.mu.Lock()
+	if r.p.rooms[r.infoHash] == r {
+		delete(r.p.rooms, r.infoHash)
+		for _, cl := range r.p.clients {
+			go cl.Leave(r.infoHash)
+		}
+	}
+	r.p.mu.Unlock()
+
+	r.closeConns()
+	return nil
+}
+
+// closeConns closes the room's listener and conns, and any conn delivered later.
+func (r *Room) closeConns() {
+	r.mu.Lock()
+	r.left = true
+	conns := r.conns
+	r.conns = make(map[*webrtcNetConn]struct{})
+	r.mu.Unlock()
+
+	r.listener.Close()
+	for conn := range conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,84 @@
+package gop2pt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
+)
+
+const roomSecretContext = "gop2pt room v1"
+
+var ErrRoomSecretMismatch = errors.New("peer does not know the room secret")
+
+// WithRoomSecret makes the room private. The info hash is derived from the identifier and secret,
+// so the room can't be found from the identifier alone, and every peer has to answer an HMAC
+// challenge proving knowledge of the secret before the conn reaches Accept.
+func WithRoomSecret(secret []byte) Option {
+	return func(p *P2PT) {
+		p.roomSecret = append([]byte(nil), secret...)
+	}
+}
+
+type roomChallenge struct {
+	Nonce []byte `json:"nonce"`
+}
+
+type roomResponse struct {
+	MAC []byte `json:"mac"`
+}
+
+// roomMAC proves knowledge of the secret for the challenger's nonce, bound to the DTLS
+// fingerprints of the connection with the responder's first.
+func (p *P2PT) roomMAC(nonce []byte, responderFingerprint, challengerFingerprint string) []byte {
+	mac := hmac.New(sha256.New, p.roomSecret)
+	mac.Write([]byte(roomSecretContext))
+	mac.Write([]byte{0})
+	mac.Write(nonce)
+	mac.Write([]byte(responderFingerprint))
+	mac.Write([]byte{0})
+	mac.Write([]byte(challengerFingerprint))
+	return mac.Sum(nil)
+}
+
+func (p *P2PT) roomSecretHandshake(conn *webrtcNetConn) error {
+	local, err := webtorrent.Fingerprint(conn.Local)
+	if err != nil {
+		return fmt.Errorf("local description: %w", err)
+	}
+	remote, err := webtorrent.Fingerprint(conn.Remote)
+	if err != nil {
+		return fmt.Errorf("remote description: %w", err)
+	}
+
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	if err := writeHandshakeMessage(conn, roomChallenge{Nonce: nonce}); err != nil {
+		return fmt.Errorf("sending room challenge: %w", err)
+	}
+	var challenge roomChallenge
+	if err := readHandshakeMessage(conn, &challenge); err != nil {
+		return err
+	}
+	if len(challenge.Nonce) != len(nonce) {
+		return fmt.Errorf("%w: bad challenge", ErrRoomSecretMismatch)
+	}
+
+	err = writeHandshakeMessage(conn, roomResponse{MAC: p.roomMAC(challenge.Nonce, local, remote)})
+	if err != nil {
+		return fmt.Errorf("sending room response: %w", err)
+	}
+	var response roomResponse
+	if err := readHandshakeMessage(conn, &response); err != nil {
+		return err
+	}
+	if !hmac.Equal(response.MAC, p.roomMAC(nonce, remote, local)) {
+		return ErrRoomSecretMismatch
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package gop2pt
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRoomSecretHandshake(t *testing.T) {
+	a := New("room", nil, WithRoomSecret([]byte("secret")))
+	b := New("room", nil, WithRoomSecret([]byte("secret")))
+	if a.InfoHash() != b.InfoHash() || a.InfoHash() == New("room", nil).InfoHash() {
+		t.Fatal("info hash doesn't depend on the secret")
+	}
+	connA, connB := connPair(a.PeerID(), b.PeerID())
+	if errA, errB := runHandshakes(connA, a.roomSecretHandshake, connB, b.roomSecretHandshake); errA != nil || errB != nil {
+		t.Fatalf("handshake failed: %v, %v", errA, errB)
+	}
+}
+
+func TestRoomSecretHandshakeWrongSecret(t *testing.T) {
+	a := New("room", nil, WithRoomSecret([]byte("secret")))
+	b := New("room", nil, WithRoomSecret([]byte("guess")))
+	connA, connB := connPair(a.PeerID(), b.PeerID())
+	errA, errB := runHandshakes(connA, a.roomSecretHandshake, connB, b.roomSecretHandshake)
+	if !errors.Is(errA, ErrRoomSecretMismatch) || !errors.Is(errB, ErrRoomSecretMismatch) {
+		t.Fatalf("got errors %v, %v, want %v on both sides", errA, errB, ErrRoomSecretMismatch)
+	}
+}
+
+func TestRoomSecretHandshakeReflected(t *testing.T) {
+	a := New("room", nil, WithRoomSecret([]byte("secret")))
+	// The attacker returns our challenge as its own, then our response as its own.
+	connA, connAttacker := connPair(a.PeerID(), PeerID{1})
+	echo(connAttacker)
+	if err := a.roomSecretHandshake(connA); !errors.Is(err, ErrRoomSecretMismatch) {
+		t.Fatalf("got error %v, want %v", err, ErrRoomSecretMismatch)
+	}
+}
+
+func TestRoomSecretHandshakeFingerprintMismatch(t *testing.T) {
+	a := New("room", nil, WithRoomSecret([]byte("secret")))
+	b := New("room", nil, WithRoomSecret([]byte("secret")))
+	connA, connB := connPair(a.PeerID(), b.PeerID())
+	// A tracker relaying the handshake between two connections of its own can't make the MACs
+	// match either side.
+	connB.Remote = testDescription("CC:CC:CC:CC")
+	errA, errB := runHandshakes(connA, a.roomSecretHandshake, connB, b.roomSecretHandshake)
+	if !errors.Is(errA, ErrRoomSecretMismatch) || !errors.Is(errB, ErrRoomSecretMismatch) {
+		t.Fatalf("got errors %v, %v, want %v on both sides", errA, errB, ErrRoomSecretMismatch)
+	}
+}
@@ -0,0 +1,73 @@
+package gop2pt
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+type closeRecorder struct {
+	chanPipe
+	closed bool
+}
+
+func (cr *closeRecorder) Close() error {
+	cr.closed = true
+	return nil
+}
+
+func TestRoomCloseClosesConns(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		defaultRoom bool
+		close       func(*Room) error
+	}{
+		{"leave", false, (*Room).Leave},
+		{"close", false, (*Room).Close},
+		{"close default room", true, (*Room).Close},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := New("room close", nil)
+			var room *Room
+			if tc.defaultRoom {
+				room = newRoom(p, p.infoHash)
+				p.rooms[p.infoHash] = room
+				p.defaultRoom = room
+			} else {
+				var err error
+				if room, err = p.Join("other room"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			rec := &closeRecorder{}
+			go room.deliver(&webrtcNetConn{ReadWriteCloser: rec})
+			if _, err := room.Accept(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tc.close(room); err != nil {
+				t.Fatal(err)
+			}
+			if !rec.closed {
+				t.Error("conn left open")
+			}
+			if _, err := room.Accept(); !errors.Is(err, net.ErrClosed) {
+				t.Errorf("Accept returned %v, want %v", err, net.ErrClosed)
+			}
+			late := &closeRecorder{}
+			room.deliver(&webrtcNetConn{ReadWriteCloser: late})
+			if !late.closed {
+				t.Error("conn delivered after closing left open")
+			}
+			p.mu.Lock()
+			closed, joined := p.closed, p.rooms[room.infoHash] != nil
+			p.mu.Unlock()
+			if closed != tc.defaultRoom {
+				t.Errorf("P2PT closed %v, want %v", closed, tc.defaultRoom)
+			}
+			if !tc.defaultRoom && joined {
+				t.Error("room still joined")
+			}
+		})
+	}
+}
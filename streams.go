@@ -0,0 +1,102 @@
+package gop2pt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/pion/datachannel"
+)
+
+// FeatureStreams is advertised in the capability handshake with WithStreams.
+const FeatureStreams = "streams"
+
+const streamLabel = "gop2pt-stream"
+
+// Streams the peer opened that haven't been accepted yet. Further ones are closed.
+const maxPendingStreams = 16
+
+var ErrStreamsNotNegotiated = errors.New("peer did not negotiate streams")
+
+// WithStreams lets either side of a conn open further conns to the same peer with
+// Conn.OpenStream, each on its own data channel of the same peer connection, so they don't block
+// each other. The peer accepts them with Conn.AcceptStream. It enables the capability handshake,
+// see WithCapabilities, and streams are only available with peers that advertise FeatureStreams
+// in it. Streams share the negotiated features of their conn and close with it.
+func WithStreams() Option {
+	return func(p *P2PT) {
+		p.streams = true
+		if p.capabilities == nil {
+			p.capabilities = &Capabilities{}
+		}
+	}
+}
+
+type streamSet struct {
+	accept    chan *webrtcNetConn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *streamSet) close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+// startStreams hands the data channels the peer opens to AcceptStream, or closes them if streams
+// weren't negotiated.
+func (c *webrtcNetConn) startStreams() {
+	c.DataChannelContext.OnDataChannel(func(raw datachannel.ReadWriteCloser) {
+		if c.streams == nil {
+			raw.Close()
+			return
+		}
+		select {
+		case c.streams.accept <- c.newStream(raw):
+		default:
+			raw.Close()
+		}
+	})
+}
+
+func (c *webrtcNetConn) newStream(raw datachannel.ReadWriteCloser) *webrtcNetConn {
+	return &webrtcNetConn{
+		ReadWriteCloser:    raw,
+		DataChannelContext: c.DataChannelContext,
+		publicKey:          c.publicKey,
+		chunkSize:          c.chunkSize,
+		framing:            c.framing,
+		compression:        c.compression,
+		capabilities:       c.capabilities,
+	}
+}
+
+func (c *webrtcNetConn) OpenStream(ctx context.Context) (Conn, error) {
+	if c.streams == nil {
+		return nil, ErrStreamsNotNegotiated
+	}
+	raw, err := c.OpenDataChannel(ctx, streamLabel)
+	if err != nil {
+		return nil, err
+	}
+	return c.newStream(raw), nil
+}
+
+func (c *webrtcNetConn) AcceptStream() (Conn, error) {
+	if c.streams == nil {
+		return nil, ErrStreamsNotNegotiated
+	}
+	select {
+	case s := <-c.streams.accept:
+		return s, nil
+	case <-c.streams.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (c *webrtcNetConn) Close() error {
+	if c.streams != nil {
+		c.streams.close()
+	}
+	return c.ReadWriteCloser.Close()
+}
@@ -0,0 +1,315 @@
+package gop2pt
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/DaniilSokolyuk/gop2pt/event"
+	dslog "github.com/DaniilSokolyuk/gop2pt/log"
+)
+
+var (
+	// How long a tracker gets to accept the websocket before the next one is tried.
+	trackerFailoverTimeout = time.Second * 15
+	// How long to wait before trying the tiers above the tracker in use, or every tier when none
+	// is reachable. The wait doubles after each attempt that doesn't reach the first tier.
+	tierRetryMinBackoff = time.Second * 5
+	tierRetryMaxBackoff = time.Minute * 5
+)
+
+// WithAnnounceList announces to trackers in BEP 12 tiers instead of to every announce URL at once.
+// Only one tracker is used at a time. The trackers of a tier are shuffled once and tried one at a
+// time, and the first to accept the websocket is moved to the front of its tier. Lower tiers are only tried when every
+// tracker of the tiers above is down. The tiers above are retried with a growing backoff, and the
+// lower tier is given up as soon as one of them recovers. The tiers replace the announce URLs
+// passed to New.
+func WithAnnounceList(tiers [][]string) Option {
+	return func(p *P2PT) {
+		t := &trackerTiers{}
+		for _, tier := range tiers {
+			if len(tier) == 0 {
+				continue
+			}
+			tier = append([]string(nil), tier...)
+			rand.Shuffle(len(tier), func(i, j int) {
+				tier[i], tier[j] = tier[j], tier[i]
+			})
+			t.tiers = append(t.tiers, tier)
+		}
+		p.tiers = t
+	}
+}
+
+type trackerTiers struct {
+	mu    sync.Mutex
+	tiers [][]string
+	// The tracker in use, or empty.
+	active      string
+	failingOver bool
+	// Failover was asked for while failing over, and runs again once done.
+	again bool
+
+	// Retrying the tiers above the active tracker.
+	retry   *time.Timer
+	backoff time.Duration
+	stopped bool
+}
+
+// snapshot returns a copy of the tiers, in the order they should be tried.
+func (t *trackerTiers) snapshot() [][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tiers := make([][]string, len(t.tiers))
+	for i, tier := range t.tiers {
+		tiers[i] = append([]string(nil), tier...)
+	}
+	return tiers
+}
+
+// promote moves url to the front of its tier. Must be called with t.mu held.
+func (t *trackerTiers) promote(url string) {
+	for _, tier := range t.tiers {
+		for i := range tier {
+			if tier[i] == url {
+				copy(tier[1:i+1], tier[:i])
+				tier[0] = url
+				return
+			}
+		}
+	}
+}
+
+// contains reports whether url is in a tier. Must be called with t.mu held.
+func (t *trackerTiers) contains(url string) bool {
+	for _, tier := range t.tiers {
+		for _, u := range tier {
+			if u == url {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// add appends url as a tier of its own, unless it is in a tier already.
+func (t *trackerTiers) add(url string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.contains(url) {
+		return false
+	}
+	t.tiers = append(t.tiers, []string{url})
+	return true
+}
+
+// remove takes url out of its tier, dropping the tier if it ends up empty, and reports whether url
+// was in a tier and whether it was the tracker in use, which is then no longer.
+func (t *trackerTiers) remove(url string) (found, active bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, tier := range t.tiers {
+		for j := range tier {
+			if tier[j] != url {
+				continue
+			}
+			tier = append(tier[:j:j], tier[j+1:]...)
+			if len(tier) == 0 {
+				t.tiers = append(t.tiers[:i:i], t.tiers[i+1:]...)
+			} else {
+				t.tiers[i] = tier
+			}
+			active = t.active == url
+			if active {
+				t.active = ""
+			}
+			return true, active
+		}
+	}
+	return false, false
+}
+
+func (t *trackerTiers) activeURL() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.active
+}
+
+// failover switches to the first tracker that accepts a connection, walking the tiers from the
+// top. The active tracker is kept until another one works, and if none does. Unless it ends up on
+// the first tier, it schedules another attempt.
+func (p *P2PT) failover() {
+	t := p.tiers
+	t.mu.Lock()
+	if t.failingOver || t.stopped {
+		t.again = t.failingOver && !t.stopped
+		t.mu.Unlock()
+		return
+	}
+	t.failingOver = true
+	active := t.active
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.failingOver = false
+		again := t.again && !t.stopped
+		t.again = false
+		t.mu.Unlock()
+		if again {
+			go p.failover()
+		}
+	}()
+
+	for i, tier := range t.snapshot() {
+		candidates := make([]string, 0, len(tier))
+		for _, url := range tier {
+			if url == active {
+				if p.trackerConnected(url) {
+					p.scheduleFailover(i > 0)
+					return
+				}
+				continue
+			}
+			candidates = append(candidates, url)
+		}
+		select {
+		case <-p.stopCh:
+			return
+		default:
+		}
+		url := p.probeTier(candidates)
+		if url == "" {
+			continue
+		}
+		t.mu.Lock()
+		if !t.contains(url) {
+			// Removed while it was being tried.
+			t.mu.Unlock()
+			p.releaseTracker(url)
+			continue
+		}
+		t.promote(url)
+		prev := t.active
+		t.active = url
+		t.mu.Unlock()
+		if prev != "" {
+			p.releaseTracker(prev)
+		}
+		p.logger.Info("announcing to tracker", dslog.KeyTracker, url)
+		p.scheduleFailover(i > 0)
+		return
+	}
+	p.logger.Warn("no tracker of the announce list is reachable")
+	p.scheduleFailover(true)
+}
+
+// probeTier tries the trackers of tier one at a time, in order. It keeps the first to accept the
+// websocket and returns an empty string if none does in time.
+func (p *P2PT) probeTier(tier []string) string {
+	for _, url := range tier {
+		select {
+		case <-p.stopCh:
+			return ""
+		default:
+		}
+		p.tiers.mu.Lock()
+		removed := !p.tiers.contains(url)
+		p.tiers.mu.Unlock()
+		if removed {
+			continue
+		}
+		if p.connectTrackerAndWait(url) {
+			return url
+		}
+		p.releaseTracker(url)
+	}
+	return ""
+}
+
+// scheduleFailover retries failover after the backoff if retry is set, and otherwise resets the
+// backoff, as the first tier is in use.
+func (p *P2PT) scheduleFailover(retry bool) {
+	t := p.tiers
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !retry {
+		t.backoff = 0
+		if t.retry != nil {
+			t.retry.Stop()
+		}
+		return
+	}
+	if t.stopped {
+		return
+	}
+	if t.backoff == 0 {
+		t.backoff = tierRetryMinBackoff
+	}
+	if t.retry == nil {
+		t.retry = time.AfterFunc(t.backoff, p.failover)
+	} else {
+		t.retry.Reset(t.backoff)
+	}
+	t.backoff *= 2
+	if t.backoff > tierRetryMaxBackoff {
+		t.backoff = tierRetryMaxBackoff
+	}
+}
+
+// stop cancels any scheduled failover.
+func (t *trackerTiers) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	if t.retry != nil {
+		t.retry.Stop()
+	}
+}
+
+// onTierEvent fails over when the active tracker goes down.
+func (p *P2PT) onTierEvent(e event.Event) {
+	if e.Type != event.TrackerDisconnected && e.Type != event.TrackerConnectFailed {
+		return
+	}
+	if e.Tracker == p.tiers.activeURL() {
+		go p.failover()
+	}
+}
+
+func (p *P2PT) trackerConnected(url string) bool {
+	p.mu.Lock()
+	cl, ok := p.clients[url]
+	p.mu.Unlock()
+	return ok && cl.Connected()
+}
+
+// connectTrackerAndWait connects to url and waits up to trackerFailoverTimeout for the websocket.
+// It gives up early if dialing fails.
+func (p *P2PT) connectTrackerAndWait(url string) bool {
+	done := make(chan bool, 1)
+	remove := p.OnEvent(func(e event.Event) {
+		if e.Tracker != url || (e.Type != event.TrackerConnected && e.Type != event.TrackerConnectFailed) {
+			return
+		}
+		select {
+		case done <- e.Type == event.TrackerConnected:
+		default:
+		}
+	})
+	defer remove()
+
+	p.connectTracker(url)
+	if p.trackerConnected(url) {
+		return true
+	}
+	deadline := time.NewTimer(trackerFailoverTimeout)
+	defer deadline.Stop()
+	select {
+	case connected := <-done:
+		return connected
+	case <-deadline.C:
+		return false
+	case <-p.stopCh:
+		return false
+	}
+}
@@ -0,0 +1,152 @@
+package gop2pt
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent/server"
+)
+
+// setTierTimings shortens the failover timings for the duration of the test.
+func setTierTimings(t *testing.T, timeout, minBackoff, maxBackoff time.Duration) {
+	oldTimeout, oldMin, oldMax := trackerFailoverTimeout, tierRetryMinBackoff, tierRetryMaxBackoff
+	trackerFailoverTimeout, tierRetryMinBackoff, tierRetryMaxBackoff = timeout, minBackoff, maxBackoff
+	t.Cleanup(func() {
+		trackerFailoverTimeout, tierRetryMinBackoff, tierRetryMaxBackoff = oldTimeout, oldMin, oldMax
+	})
+}
+
+// startTracker serves a tracker on ln.
+func startTracker(t *testing.T, ln net.Listener) string {
+	srv := httptest.NewUnstartedServer(&server.Server{})
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// unusedAddr returns a local address nothing listens on.
+func unusedAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func waitActive(t *testing.T, p *P2PT, url string, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for p.tiers.activeURL() != url {
+		if time.Now().After(deadline) {
+			t.Fatalf("active tracker %q, want %q", p.tiers.activeURL(), url)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestTierFailover(t *testing.T) {
+	setTierTimings(t, time.Second, 100*time.Millisecond, 500*time.Millisecond)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fallback := startTracker(t, ln)
+	down := []string{"ws://" + unusedAddr(t), "ws://" + unusedAddr(t)}
+
+	p := New("tiers", nil, WithAnnounceList([][]string{down, {fallback}}))
+	start := time.Now()
+	if _, err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	waitActive(t, p, fallback, 10*time.Second)
+	// Refused connections move on to the next tracker without waiting for the timeout.
+	if elapsed := time.Since(start); elapsed >= trackerFailoverTimeout {
+		t.Errorf("failing over took %v, refused connections waited for the timeout", elapsed)
+	}
+
+	// The first tier is retried with a backoff, and taken back as soon as it recovers.
+	recovered := down[1]
+	ln, err = net.Listen("tcp", strings.TrimPrefix(recovered, "ws://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startTracker(t, ln)
+	waitActive(t, p, recovered, 10*time.Second)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.clients) != 1 || p.clients[recovered] == nil {
+		t.Fatalf("tracker clients left after failing back: %v", p.clients)
+	}
+}
+
+// acceptRecorder records when the first connection is accepted.
+type acceptRecorder struct {
+	net.Listener
+	first chan time.Time
+}
+
+func (ar *acceptRecorder) Accept() (net.Conn, error) {
+	c, err := ar.Listener.Accept()
+	if err == nil {
+		select {
+		case ar.first <- time.Now():
+		default:
+		}
+	}
+	return c, err
+}
+
+func TestTierProbesSequentially(t *testing.T) {
+	setTierTimings(t, 500*time.Millisecond, time.Minute, time.Minute)
+
+	// Accepts connections but never answers the websocket handshake.
+	hanging, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hanging.Close()
+	go func() {
+		for {
+			c, err := hanging.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &acceptRecorder{Listener: ln, first: make(chan time.Time, 1)}
+	working := startTracker(t, rec)
+	hangingURL := "ws://" + hanging.Addr().String()
+
+	p := New("tiers", nil, WithAnnounceList([][]string{{hangingURL, working}}))
+	// Undo the shuffle to try the hanging tracker first.
+	p.tiers.tiers = [][]string{{hangingURL, working}}
+	start := time.Now()
+	if _, err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	waitActive(t, p, working, 10*time.Second)
+	if dialed := (<-rec.first).Sub(start); dialed < trackerFailoverTimeout {
+		t.Errorf("second tracker dialed after %v, before the first timed out", dialed)
+	}
+	if got := p.tiers.snapshot()[0][0]; got != working {
+		t.Errorf("tracker %q at the front of the tier, want %q", got, working)
+	}
+}
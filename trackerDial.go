@@ -0,0 +1,116 @@
+package gop2pt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrTrackerCertificateNotPinned = errors.New("tracker certificate does not match any pinned key")
+
+// TrackerDialConfig controls how the websocket to a tracker is dialed, for private trackers that
+// need their own CA, client certificates or credentials.
+type TrackerDialConfig struct {
+	// Used for wss:// trackers, e.g. to set RootCAs or client Certificates.
+	TLSClientConfig *tls.Config
+	// Sent with every websocket handshake, e.g. Origin.
+	Header http.Header
+	// Supplies and stores cookies for the websocket handshake.
+	Jar http.CookieJar
+	// Called before every connect and reconnect. A non-empty token is sent as a bearer token in
+	// the Authorization header. An error aborts that connection attempt.
+	Token func(trackerURL string) (string, error)
+	// SHA-256 hashes of the DER encoded SubjectPublicKeyInfo of acceptable tracker leaf
+	// certificates. The certificate must still pass normal verification.
+	PinnedPublicKeys [][]byte
+}
+
+// WithTrackerDialConfig sets the dial configuration used for trackers that have none of their own.
+func WithTrackerDialConfig(config TrackerDialConfig) Option {
+	return func(p *P2PT) {
+		p.defaultDialConfig = config
+	}
+}
+
+// WithTrackerDialConfigFor sets the dial configuration for the tracker with the given announce URL.
+func WithTrackerDialConfigFor(url string, config TrackerDialConfig) Option {
+	return func(p *P2PT) {
+		if p.dialConfigs == nil {
+			p.dialConfigs = make(map[string]TrackerDialConfig)
+		}
+		p.dialConfigs[url] = config
+	}
+}
+
+func (p *P2PT) dialConfig(url string) TrackerDialConfig {
+	if config, ok := p.dialConfigs[url]; ok {
+		return config
+	}
+	return p.defaultDialConfig
+}
+
+func (p *P2PT) newDialer(config TrackerDialConfig) *websocket.Dialer {
+	dialer := &websocket.Dialer{
+		Proxy:            p.proxy,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+		Jar:              config.Jar,
+	}
+	if config.TLSClientConfig != nil {
+		dialer.TLSClientConfig = config.TLSClientConfig.Clone()
+	}
+	if len(config.PinnedPublicKeys) != 0 {
+		if dialer.TLSClientConfig == nil {
+			dialer.TLSClientConfig = &tls.Config{}
+		}
+		verify := dialer.TLSClientConfig.VerifyConnection
+		dialer.TLSClientConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(cs); err != nil {
+					return err
+				}
+			}
+			return verifyPinnedPublicKey(cs, config.PinnedPublicKeys)
+		}
+	}
+	return dialer
+}
+
+func verifyPinnedPublicKey(cs tls.ConnectionState, pins [][]byte) error {
+	if len(cs.PeerCertificates) == 0 {
+		return ErrTrackerCertificateNotPinned
+	}
+	sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+	for _, pin := range pins {
+		if bytes.Equal(pin, sum[:]) {
+			return nil
+		}
+	}
+	return ErrTrackerCertificateNotPinned
+}
+
+// dialHeader returns a function building the handshake headers for each connection attempt, so
+// that tokens are refreshed on reconnect.
+func dialHeader(url string, config TrackerDialConfig) func() (http.Header, error) {
+	return func() (http.Header, error) {
+		header := config.Header.Clone()
+		if config.Token == nil {
+			return header, nil
+		}
+		token, err := config.Token(url)
+		if err != nil {
+			return nil, fmt.Errorf("getting tracker token: %w", err)
+		}
+		if token != "" {
+			if header == nil {
+				header = make(http.Header)
+			}
+			header.Set("Authorization", "Bearer "+token)
+		}
+		return header, nil
+	}
+}
@@ -0,0 +1,162 @@
+package gop2pt
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTLSTracker starts a TLS websocket server that records the handshake headers it receives.
+func newTLSTracker(t *testing.T) (srv *httptest.Server, headers chan http.Header) {
+	t.Helper()
+	headers = make(chan http.Header, 10)
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, headers
+}
+
+func trackerPin(srv *httptest.Server) []byte {
+	sum := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	return sum[:]
+}
+
+func trustTracker(srv *httptest.Server) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	return &tls.Config{RootCAs: pool}
+}
+
+// dialTracker dials srv the way the tracker client does, with the config P2PT picks for url.
+func dialTracker(p *P2PT, srv *httptest.Server) error {
+	url := "wss" + strings.TrimPrefix(srv.URL, "https")
+	config := p.dialConfig(url)
+	header, err := dialHeader(url, config)()
+	if err != nil {
+		return err
+	}
+	conn, _, err := p.newDialer(config).Dial(url, header)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestTrackerDialPinnedKey(t *testing.T) {
+	srv, _ := newTLSTracker(t)
+	for _, tc := range []struct {
+		name   string
+		config TrackerDialConfig
+		want   error
+	}{
+		{"pin matches", TrackerDialConfig{TLSClientConfig: trustTracker(srv), PinnedPublicKeys: [][]byte{{1}, trackerPin(srv)}}, nil},
+		{"pin mismatch", TrackerDialConfig{TLSClientConfig: trustTracker(srv), PinnedPublicKeys: [][]byte{make([]byte, sha256.Size)}}, ErrTrackerCertificateNotPinned},
+		{"no pins", TrackerDialConfig{TLSClientConfig: trustTracker(srv)}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := New(t.Name(), nil, WithTrackerDialConfig(tc.config))
+			if err := dialTracker(p, srv); !errors.Is(err, tc.want) {
+				t.Fatalf("got error %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	t.Run("pin doesn't replace verification", func(t *testing.T) {
+		p := New(t.Name(), nil, WithTrackerDialConfig(TrackerDialConfig{PinnedPublicKeys: [][]byte{trackerPin(srv)}}))
+		if err := dialTracker(p, srv); err == nil {
+			t.Fatal("dialed a tracker with an untrusted certificate")
+		}
+	})
+}
+
+func TestTrackerDialHeaders(t *testing.T) {
+	srv, headers := newTLSTracker(t)
+	tokens := 0
+	config := TrackerDialConfig{
+		TLSClientConfig: trustTracker(srv),
+		Header:          http.Header{"Origin": {"https://app.example"}},
+		Token: func(url string) (string, error) {
+			if !strings.HasPrefix(url, "wss://") {
+				t.Errorf("token requested for %q", url)
+			}
+			tokens++
+			return fmt.Sprintf("token-%d", tokens), nil
+		},
+	}
+	url := "wss" + strings.TrimPrefix(srv.URL, "https")
+	// The default config doesn't trust the server, so dialing only works with the per-URL one.
+	p := New(t.Name(), nil, WithTrackerDialConfig(TrackerDialConfig{}), WithTrackerDialConfigFor(url, config))
+
+	for i := 1; i <= 2; i++ {
+		if err := dialTracker(p, srv); err != nil {
+			t.Fatal(err)
+		}
+		header := <-headers
+		if got := header.Get("Origin"); got != "https://app.example" {
+			t.Errorf("Origin %q, want the configured one", got)
+		}
+		if got, want := header.Get("Authorization"), fmt.Sprintf("Bearer token-%d", i); got != want {
+			t.Errorf("Authorization %q, want a fresh token %q", got, want)
+		}
+	}
+	if config.Header.Get("Authorization") != "" {
+		t.Fatal("configured header modified")
+	}
+}
+
+func TestTrackerDialTokenError(t *testing.T) {
+	errNoToken := errors.New("no token")
+	header, err := dialHeader("wss://tracker.example", TrackerDialConfig{
+		Token: func(string) (string, error) { return "", errNoToken },
+	})()
+	if !errors.Is(err, errNoToken) || header != nil {
+		t.Fatalf("got %v, %v, want the token error", header, err)
+	}
+
+	// An empty token sends no Authorization header.
+	header, err = dialHeader("wss://tracker.example", TrackerDialConfig{
+		Token: func(string) (string, error) { return "", nil },
+	})()
+	if err != nil || header.Get("Authorization") != "" {
+		t.Fatalf("got %v, %v, want no Authorization header", header, err)
+	}
+}
+
+// The tracker client dials with the configured dialer and headers.
+func TestTrackerDialFromClient(t *testing.T) {
+	srv, headers := newTLSTracker(t)
+	url := "wss" + strings.TrimPrefix(srv.URL, "https")
+	p := New(t.Name(), []string{url}, WithTrackerDialConfigFor(url, TrackerDialConfig{
+		TLSClientConfig:  trustTracker(srv),
+		PinnedPublicKeys: [][]byte{trackerPin(srv)},
+		Token:            func(string) (string, error) { return "secret", nil },
+	}))
+	if _, err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	select {
+	case header := <-headers:
+		if got := header.Get("Authorization"); got != "Bearer secret" {
+			t.Fatalf("Authorization %q, want the token", got)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("tracker not dialed")
+	}
+}
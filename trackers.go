@@ -0,0 +1,178 @@
+package gop2pt
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sort"
+
+	"github.com/DaniilSokolyuk/gop2pt/event"
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
+)
+
+var ErrUnknownTracker = errors.New("tracker not added")
+
+// TrackerStats counts a tracker's dials and the conns and signaling it brought, and scores how well
+// it yields peers.
+type TrackerStats = webtorrent.TrackerClientStats
+
+// WithScoredOffers spends budget offers per announce across all connected trackers in proportion
+// to their Score, instead of NumWant at each, so that trackers that rarely produce peers get fewer
+// offers. Every connected tracker keeps at least one offer, so that its score can recover. A tracker
+// that connects announces its share right away.
+func WithScoredOffers(budget int) Option {
+	return func(p *P2PT) {
+		p.offerBudget = budget
+	}
+}
+
+// spendOfferBudget sets the NumWant of every connected tracker to its share of the offer budget.
+// The tracker at connecting counts as connected, as its websocket is just being set up.
+func (p *P2PT) spendOfferBudget(connecting string) {
+	p.mu.Lock()
+	all := make([]*refCountedWebtorrentTrackerClient, 0, len(p.clients))
+	for _, cl := range p.clients {
+		all = append(all, cl)
+	}
+	p.mu.Unlock()
+
+	var clients []*refCountedWebtorrentTrackerClient
+	var scores []float64
+	for _, cl := range all {
+		if cl.Url != connecting && !cl.Connected() {
+			continue
+		}
+		clients = append(clients, cl)
+		scores = append(scores, cl.Stats().Score)
+	}
+	for i, numWant := range allocateOffers(p.offerBudget, scores) {
+		clients[i].SetNumWant(numWant)
+	}
+}
+
+// allocateOffers splits budget in proportion to scores, giving each at least one offer. Without
+// any score to go by, each gets one.
+func allocateOffers(budget int, scores []float64) []int {
+	var total float64
+	for _, score := range scores {
+		total += score
+	}
+	numWants := make([]int, len(scores))
+	for i, score := range scores {
+		numWant := 1
+		if total > 0 {
+			numWant = int(math.Round(float64(budget) * score / total))
+		}
+		if numWant < 1 {
+			numWant = 1
+		}
+		numWants[i] = numWant
+	}
+	return numWants
+}
+
+// onBudgetEvent spends the offer budget when a tracker connects, before its first announce.
+func (p *P2PT) onBudgetEvent(e event.Event) {
+	if e.Type == event.TrackerConnected {
+		p.spendOfferBudget(e.Tracker)
+	}
+}
+
+// TrackerStatus describes a tracker in use, as returned by Trackers.
+type TrackerStatus struct {
+	URL string
+	// Whether the websocket to the tracker is up.
+	Connected bool
+	Stats     TrackerStats
+}
+
+// AddTracker starts announcing every room to url as well. Trackers are reference counted, so a
+// tracker added twice has to be removed twice. Trackers added before Start are connected by Start.
+//
+// With WithAnnounceList, url is added as a tier of its own below the others instead, and is used
+// once the trackers above it are down. Adding a tracker that is in a tier already does nothing.
+func (p *P2PT) AddTracker(url string) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return net.ErrClosed
+	}
+	started := p.defaultRoom != nil
+	if p.tiers != nil {
+		p.mu.Unlock()
+		if p.tiers.add(url) && started && p.tiers.activeURL() == "" {
+			go p.failover()
+		}
+		return nil
+	}
+	if !started {
+		p.announceURLs = append(p.announceURLs, url)
+		p.mu.Unlock()
+		return nil
+	}
+	p.mu.Unlock()
+	p.connectTracker(url)
+	return nil
+}
+
+// RemoveTracker undoes AddTracker, or the announce URL passed to New. Once the last reference is
+// gone, the tracker is told that every room stopped, offers still awaiting an answer are closed and
+// the websocket is closed. Established conns to peers found through it stay open.
+//
+// With WithAnnounceList, url is taken out of its tier. If it is the tracker in use, the P2PT fails
+// over to another one.
+func (p *P2PT) RemoveTracker(url string) error {
+	p.mu.Lock()
+	started := p.defaultRoom != nil
+	if p.tiers != nil {
+		p.mu.Unlock()
+		found, active := p.tiers.remove(url)
+		if !found {
+			return ErrUnknownTracker
+		}
+		if active {
+			p.releaseTracker(url)
+			go p.failover()
+		}
+		return nil
+	}
+	if !started {
+		defer p.mu.Unlock()
+		for i := range p.announceURLs {
+			if p.announceURLs[i] == url {
+				p.announceURLs = append(p.announceURLs[:i:i], p.announceURLs[i+1:]...)
+				return nil
+			}
+		}
+		return ErrUnknownTracker
+	}
+	p.mu.Unlock()
+	if !p.releaseTracker(url) {
+		return ErrUnknownTracker
+	}
+	return nil
+}
+
+// Trackers returns the trackers in use, sorted by URL. With WithAnnounceList, that is the active
+// tracker and any being tried.
+func (p *P2PT) Trackers() []TrackerStatus {
+	p.mu.Lock()
+	clients := make([]*refCountedWebtorrentTrackerClient, 0, len(p.clients))
+	for _, cl := range p.clients {
+		clients = append(clients, cl)
+	}
+	p.mu.Unlock()
+
+	trackers := make([]TrackerStatus, 0, len(clients))
+	for _, cl := range clients {
+		trackers = append(trackers, TrackerStatus{
+			URL:       cl.Url,
+			Connected: cl.Connected(),
+			Stats:     cl.Stats(),
+		})
+	}
+	sort.Slice(trackers, func(i, j int) bool {
+		return trackers[i].URL < trackers[j].URL
+	})
+	return trackers
+}
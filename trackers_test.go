@@ -0,0 +1,186 @@
+package gop2pt
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTracker serves a tracker on a local port.
+func newTracker(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startTracker(t, ln)
+}
+
+// waitTrackers waits until the trackers in use are exactly urls, in order.
+func waitTrackers(t *testing.T, p *P2PT, timeout time.Duration, urls ...string) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		var got []string
+		for _, status := range p.Trackers() {
+			got = append(got, status.URL)
+		}
+		if reflect.DeepEqual(got, urls) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("trackers in use %q, want %q", got, urls)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// sortedURLs returns a and b in the order Trackers lists them.
+func sortedURLs(a, b string) []string {
+	if b < a {
+		return []string{b, a}
+	}
+	return []string{a, b}
+}
+
+func TestAddRemoveTrackerBeforeStart(t *testing.T) {
+	a, b := newTracker(t), newTracker(t)
+	p := New("trackers", []string{a})
+	if err := p.AddTracker(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RemoveTracker(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RemoveTracker(a); !errors.Is(err, ErrUnknownTracker) {
+		t.Fatalf("removing a tracker twice returned %v, want %v", err, ErrUnknownTracker)
+	}
+	if _, err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	waitTrackers(t, p, 5*time.Second, b)
+}
+
+func TestAddRemoveTrackerAfterStart(t *testing.T) {
+	a, b := newTracker(t), newTracker(t)
+	p := New("trackers", []string{a})
+	if _, err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	waitTrackers(t, p, 5*time.Second, a)
+
+	if err := p.AddTracker(b); err != nil {
+		t.Fatal(err)
+	}
+	want := sortedURLs(a, b)
+	waitTrackers(t, p, 5*time.Second, want...)
+	if err := p.RemoveTracker(a); err != nil {
+		t.Fatal(err)
+	}
+	waitTrackers(t, p, 5*time.Second, b)
+	if err := p.RemoveTracker(a); !errors.Is(err, ErrUnknownTracker) {
+		t.Fatalf("removing a tracker twice returned %v, want %v", err, ErrUnknownTracker)
+	}
+}
+
+func TestAddRemoveTierTrackerBeforeStart(t *testing.T) {
+	setTierTimings(t, time.Second, time.Minute, time.Minute)
+	down, working := "ws://"+unusedAddr(t), newTracker(t)
+	p := New("tiers", nil, WithAnnounceList([][]string{{down}}))
+	if err := p.AddTracker(working); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RemoveTracker(down); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RemoveTracker(down); !errors.Is(err, ErrUnknownTracker) {
+		t.Fatalf("removing a tracker twice returned %v, want %v", err, ErrUnknownTracker)
+	}
+	if got := p.tiers.snapshot(); !reflect.DeepEqual(got, [][]string{{working}}) {
+		t.Fatalf("tiers %q, want the added tracker only", got)
+	}
+	if _, err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	waitActive(t, p, working, 5*time.Second)
+	waitTrackers(t, p, 5*time.Second, working)
+}
+
+func TestAddRemoveTierTrackerAfterStart(t *testing.T) {
+	setTierTimings(t, time.Second, time.Minute, time.Minute)
+	down, first, second := "ws://"+unusedAddr(t), newTracker(t), newTracker(t)
+	p := New("tiers", nil, WithAnnounceList([][]string{{down}}))
+	if _, err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// Nothing is reachable, so an added tracker is used right away.
+	if err := p.AddTracker(first); err != nil {
+		t.Fatal(err)
+	}
+	waitActive(t, p, first, 5*time.Second)
+	if err := p.AddTracker(second); err != nil {
+		t.Fatal(err)
+	}
+	waitTrackers(t, p, 5*time.Second, first)
+
+	// Removing the tracker in use fails over to another one, and not back to it.
+	if err := p.RemoveTracker(first); err != nil {
+		t.Fatal(err)
+	}
+	waitActive(t, p, second, 5*time.Second)
+	waitTrackers(t, p, 5*time.Second, second)
+	if got, want := p.tiers.snapshot(), [][]string{{down}, {second}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("tiers %q, want %q", got, want)
+	}
+	if err := p.RemoveTracker(first); !errors.Is(err, ErrUnknownTracker) {
+		t.Fatalf("removing a tracker twice returned %v, want %v", err, ErrUnknownTracker)
+	}
+}
+
+func TestAllocateOffers(t *testing.T) {
+	for _, tc := range []struct {
+		budget int
+		scores []float64
+		want   []int
+	}{
+		{10, []float64{0.25}, []int{10}},
+		{10, []float64{0.3, 0.1, 0.1}, []int{6, 2, 2}},
+		// Every tracker keeps one offer, so a poor score can recover.
+		{10, []float64{0.5, 0.001}, []int{10, 1}},
+		{10, []float64{0, 0}, []int{1, 1}},
+		{10, nil, []int{}},
+	} {
+		if got := allocateOffers(tc.budget, tc.scores); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("allocateOffers(%d, %v) = %v, want %v", tc.budget, tc.scores, got, tc.want)
+		}
+	}
+}
+
+// The first announce after connecting already spends the budget instead of NumWant.
+func TestScoredOffersFirstAnnounce(t *testing.T) {
+	url := newTracker(t)
+	p := New("scored offers", []string{url}, NumWant(5), WithScoredOffers(3))
+	if _, err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if trackers := p.Trackers(); len(trackers) == 1 && trackers[0].Stats.OffersSent > 0 {
+			if sent := trackers[0].Stats.OffersSent; sent != 3 {
+				t.Fatalf("first announce sent %d offers, want the budget of 3", sent)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no offers announced")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
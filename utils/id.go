@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mr-tron/base58"
+)
+
+var ErrInvalidID = errors.New("invalid 20 byte id")
+
+// PeerID identifies a peer in a swarm. On the tracker wire it is a JSON string with one character
+// per byte.
+type PeerID [20]byte
+
+// InfoHash identifies a swarm. On the tracker wire it is a JSON string with one character per byte.
+type InfoHash [20]byte
+
+// ParsePeerID parses a peer ID in hex, base32 or base58.
+func ParsePeerID(s string) (PeerID, error) {
+	b, err := parseID(s)
+	return PeerID(b), err
+}
+
+// ParseInfoHash parses an info hash in hex, base32 or base58.
+func ParseInfoHash(s string) (InfoHash, error) {
+	b, err := parseID(s)
+	return InfoHash(b), err
+}
+
+// parseID tells the encodings apart by length: hex takes 40 characters, base32 32 and base58 at
+// most 28.
+func parseID(s string) (id [20]byte, err error) {
+	var b []byte
+	switch len(s) {
+	case 2 * len(id):
+		b, err = hex.DecodeString(s)
+	case base32.StdEncoding.EncodedLen(len(id)):
+		b, err = base32.StdEncoding.DecodeString(strings.ToUpper(s))
+	default:
+		b, err = base58.Decode(s)
+	}
+	if err != nil {
+		return id, fmt.Errorf("%w: %q: %v", ErrInvalidID, s, err)
+	}
+	if len(b) != len(id) {
+		return id, fmt.Errorf("%w: %q decodes to %d bytes", ErrInvalidID, s, len(b))
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// PeerIDFromJsonString validates and converts a peer ID as it appears on the tracker wire.
+func PeerIDFromJsonString(s string) (PeerID, error) {
+	id, err := idFromJsonString(s)
+	return PeerID(id), err
+}
+
+func idFromJsonString(s string) (id [20]byte, err error) {
+	var b []byte
+	for _, r := range s {
+		if r > 0xff {
+			return id, fmt.Errorf("%w: %q has characters beyond latin-1", ErrInvalidID, s)
+		}
+		b = append(b, byte(r))
+	}
+	if len(b) != len(id) {
+		return id, fmt.Errorf("%w: %q has %d characters", ErrInvalidID, s, len(b))
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+func unmarshalJsonID(data []byte, id *[20]byte) (err error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*id, err = idFromJsonString(s)
+	return err
+}
+
+// String returns the peer ID in base58, as used in conn addresses.
+func (id PeerID) String() string { return id.Base58() }
+
+func (id PeerID) Hex() string        { return hex.EncodeToString(id[:]) }
+func (id PeerID) Base32() string     { return base32.StdEncoding.EncodeToString(id[:]) }
+func (id PeerID) Base58() string     { return base58.Encode(id[:]) }
+func (id PeerID) IsZero() bool       { return id == PeerID{} }
+func (id PeerID) JsonString() string { return BinaryToJsonString(id[:]) }
+
+// Compare orders peer IDs bytewise, returning -1, 0 or 1.
+func (id PeerID) Compare(other PeerID) int { return bytes.Compare(id[:], other[:]) }
+
+func (id PeerID) MarshalJSON() ([]byte, error) { return json.Marshal(id.JsonString()) }
+func (id *PeerID) UnmarshalJSON(data []byte) error {
+	return unmarshalJsonID(data, (*[20]byte)(id))
+}
+
+// String returns the info hash in hex, as BitTorrent clients show it.
+func (ih InfoHash) String() string { return ih.Hex() }
+
+func (ih InfoHash) Hex() string        { return hex.EncodeToString(ih[:]) }
+func (ih InfoHash) Base32() string     { return base32.StdEncoding.EncodeToString(ih[:]) }
+func (ih InfoHash) Base58() string     { return base58.Encode(ih[:]) }
+func (ih InfoHash) IsZero() bool       { return ih == InfoHash{} }
+func (ih InfoHash) JsonString() string { return BinaryToJsonString(ih[:]) }
+
+// Compare orders info hashes bytewise, returning -1, 0 or 1.
+func (ih InfoHash) Compare(other InfoHash) int { return bytes.Compare(ih[:], other[:]) }
+
+func (ih InfoHash) MarshalJSON() ([]byte, error) { return json.Marshal(ih.JsonString()) }
+func (ih *InfoHash) UnmarshalJSON(data []byte) error {
+	return unmarshalJsonID(data, (*[20]byte)(ih))
+}
+
+// InfoHashFromV2 truncates a BitTorrent v2 SHA-256 info hash to 20 bytes, as BEP 52 does for
+// tracker announces.
+func InfoHashFromV2(v2 [32]byte) (ih InfoHash) {
+	copy(ih[:], v2[:])
+	return
+}
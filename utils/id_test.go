@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testID = PeerID{0x00, 0x01, 0x7f, 0x80, 0xff, 0x22, 0x5c, 0x0a, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21}
+
+func TestParsePeerID(t *testing.T) {
+	for _, s := range []string{testID.Hex(), strings.ToUpper(testID.Hex()), testID.Base32(), strings.ToLower(testID.Base32()), testID.Base58()} {
+		got, err := ParsePeerID(s)
+		if err != nil {
+			t.Errorf("ParsePeerID(%q): %v", s, err)
+			continue
+		}
+		if got != testID {
+			t.Errorf("ParsePeerID(%q) = %x, want %x", s, got, testID)
+		}
+	}
+
+	ih, err := ParseInfoHash(InfoHash(testID).Hex())
+	if err != nil || ih != InfoHash(testID) {
+		t.Errorf("ParseInfoHash = %x, %v, want %x", ih, err, testID)
+	}
+}
+
+func TestParsePeerIDRejectsMalformed(t *testing.T) {
+	for _, s := range []string{
+		"",
+		testID.Hex()[:38],
+		"zz" + testID.Hex()[2:],
+		"0" + testID.Base32()[1:31] + "=",
+		"0OIl",
+		PeerID{}.Base58() + "11",
+	} {
+		if _, err := ParsePeerID(s); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("ParsePeerID(%q) returned %v, want %v", s, err, ErrInvalidID)
+		}
+	}
+}
+
+func TestPeerIDJSONRoundTrip(t *testing.T) {
+	data, err := json.Marshal(testID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got PeerID
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != testID {
+		t.Fatalf("round trip through %s gave %x, want %x", data, got, testID)
+	}
+
+	fromString, err := PeerIDFromJsonString(testID.JsonString())
+	if err != nil || fromString != testID {
+		t.Fatalf("PeerIDFromJsonString = %x, %v, want %x", fromString, err, testID)
+	}
+
+	var ih InfoHash
+	if err := json.Unmarshal(data, &ih); err != nil || ih != InfoHash(testID) {
+		t.Fatalf("InfoHash round trip gave %x, %v, want %x", ih, err, testID)
+	}
+}
+
+func TestPeerIDJSONRejectsMalformed(t *testing.T) {
+	for _, s := range []string{
+		"",
+		strings.Repeat("a", 19),
+		strings.Repeat("a", 21),
+		strings.Repeat("a", 19) + "Ā",
+		strings.Repeat("a", 19) + "☃",
+	} {
+		if _, err := PeerIDFromJsonString(s); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("PeerIDFromJsonString(%q) returned %v, want %v", s, err, ErrInvalidID)
+		}
+		data, _ := json.Marshal(s)
+		var id PeerID
+		if err := json.Unmarshal(data, &id); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("unmarshalling %s returned %v, want %v", data, err, ErrInvalidID)
+		}
+	}
+}
@@ -1,27 +1,41 @@
 package utils
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha1"
 )
 
-func MakePeerID() string {
-	peerIDB := make([]byte, 20)
-	rand.Read(peerIDB)
+func MakePeerID() PeerID {
+	return MakePeerIDWithPrefix("")
+}
 
-	var peerID [20]byte
-	copy(peerID[:], peerIDB)
+// MakePeerIDWithPrefix makes a random peer ID starting with prefix, such as the BitTorrent
+// client prefix "-GP0001-". Prefixes longer than a peer ID are truncated.
+func MakePeerIDWithPrefix(prefix string) PeerID {
+	var peerID PeerID
+	rand.Read(peerID[:])
+	copy(peerID[:], prefix)
 
-	return BinaryToJsonString(peerID[:])
+	return peerID
 }
 
-func MakeInfoHash(s string) string {
-	var infoHash [20]byte
+func MakeInfoHash(s string) InfoHash {
+	var infoHash InfoHash
 	hash := sha1.New()
 	hash.Write([]byte(s))
 	copy(infoHash[:], hash.Sum(nil))
 
-	return BinaryToJsonString(infoHash[:])
+	return infoHash
+}
+
+// MakeSecretInfoHash derives the info hash of a private room, which can't be computed without
+// knowing the secret.
+func MakeSecretInfoHash(s string, secret []byte) (infoHash InfoHash) {
+	mac := hmac.New(sha1.New, secret)
+	mac.Write([]byte(s))
+	copy(infoHash[:], mac.Sum(nil))
+	return
 }
 
 func BinaryToJsonString(b []byte) string {
@@ -31,3 +45,12 @@ func BinaryToJsonString(b []byte) string {
 	}
 	return string(seq)
 }
+
+// JsonStringToBinary reverses BinaryToJsonString.
+func JsonStringToBinary(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		b = append(b, byte(r))
+	}
+	return b
+}
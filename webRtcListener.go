@@ -2,12 +2,14 @@ package gop2pt
 
 import (
 	"net"
+	"sync"
 )
 
 type webrtcListener struct {
-	onConn chan *webrtcNetConn
-	stopCh chan struct{}
-	addr   net.Addr
+	onConn    chan *webrtcNetConn
+	stopCh    chan struct{}
+	closeOnce sync.Once
+	addr      net.Addr
 }
 
 func (w *webrtcListener) Accept() (net.Conn, error) {
@@ -19,9 +21,19 @@ func (w *webrtcListener) Accept() (net.Conn, error) {
 	}
 }
 
+// deliver hands conn to Accept, or closes it if the listener is closed first.
+func (w *webrtcListener) deliver(conn *webrtcNetConn) {
+	select {
+	case w.onConn <- conn:
+	case <-w.stopCh:
+		conn.Close()
+	}
+}
+
 func (w *webrtcListener) Close() error {
-	close(w.onConn)
-	close(w.stopCh)
+	w.closeOnce.Do(func() {
+		close(w.stopCh)
+	})
 
 	return nil
 }
@@ -1,10 +1,12 @@
 package gop2pt
 
 import (
+	"context"
+	"crypto/ed25519"
 	"net"
+	"sync"
 	"time"
 
-	"github.com/mr-tron/base58"
 	"github.com/pion/datachannel"
 
 	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
@@ -12,40 +14,190 @@ import (
 
 const webrtcNetwork = "webrtc"
 
+// The largest message we accept. We don't advertise a max-message-size, so per RFC 8841 peers keep
+// to the 64 KiB default, as pion and browsers do.
+const maxMessageSize = webtorrent.DefaultMaxMessageSize
+
+// Errors returned from conn reads and writes when the remote peer goes away.
+var (
+	ErrPeerConnectionFailed = webtorrent.ErrPeerConnectionFailed
+	ErrPeerConnectionClosed = webtorrent.ErrPeerConnectionClosed
+	ErrPeerDisconnected     = webtorrent.ErrPeerDisconnected
+	ErrHeartbeatTimeout     = webtorrent.ErrHeartbeatTimeout
+)
+
+// Conn is implemented by the net.Conns returned from the listener's Accept.
+type Conn interface {
+	net.Conn
+	// Reconnected reports whether this conn re-establishes a connection to a peer that was lost
+	// recently. It is always false without WithReconnect.
+	Reconnected() bool
+	// PublicKey returns the remote's verified identity key, or nil without WithIdentity.
+	PublicKey() ed25519.PublicKey
+	// ReadMessage reads the next message whole, or the rest of it if Read consumed part of it
+	// already. With framing, see WithMessageFraming, a message is what the remote passed to one
+	// WriteMessage or Write call, however many data channel messages it took.
+	ReadMessage() ([]byte, error)
+	// WriteMessage sends p as a single message. Unless framing was negotiated, p must fit the
+	// remote's max-message-size.
+	WriteMessage(p []byte) error
+	// Capabilities returns the outcome of the capability handshake, or nil without
+	// WithCapabilities.
+	Capabilities() *PeerCapabilities
+	// OpenStream opens another conn to the peer, see WithStreams. It fails with
+	// ErrStreamsNotNegotiated unless both sides enabled streams.
+	OpenStream(ctx context.Context) (Conn, error)
+	// AcceptStream waits for the next stream the peer opens, until the conn is closed.
+	AcceptStream() (Conn, error)
+}
+
 type webrtcNetConn struct {
 	datachannel.ReadWriteCloser
 	webtorrent.DataChannelContext
+	reconnected bool
+	publicKey   ed25519.PublicKey
+	// Largest message the remote accepts from us.
+	chunkSize    int
+	framing      bool
+	compression  bool
+	capabilities *PeerCapabilities
+	// Set if the peer negotiated FeatureStreams, see WithStreams.
+	streams *streamSet
+
+	writeMu sync.Mutex
+
+	readMu sync.Mutex
+	// Scratch space for messages that don't fit the caller's buffer, allocated on first use.
+	readBuf []byte
+	// Unread remainder of the last message.
+	pending []byte
+	// With framing, the payload bytes of the current record not read yet.
+	recordLeft int
+	// With compression, the unread remainder of the last record, inflated.
+	inflated []byte
+}
+
+// Read treats the data channel as a byte stream. Messages that don't fit p are buffered and
+// returned by subsequent reads, rather than failing with io.ErrShortBuffer and losing the rest.
+func (c *webrtcNetConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if c.framing {
+		return c.readFramed(p)
+	}
+	for len(c.pending) == 0 {
+		if len(p) >= maxMessageSize {
+			// Any message fits, so skip the copy.
+			for {
+				n, _, err := c.ReadWriteCloser.ReadDataChannel(p)
+				if n > 0 || err != nil {
+					return n, err
+				}
+			}
+		}
+		if err := c.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// readFramed reads the payload of records as a byte stream, skipping their length prefixes.
+func (c *webrtcNetConn) readFramed(p []byte) (int, error) {
+	if c.compression {
+		// Records can only be inflated whole.
+		for len(c.inflated) == 0 {
+			msg, err := c.readRecord()
+			if err != nil {
+				return 0, err
+			}
+			c.inflated = msg
+		}
+		n := copy(p, c.inflated)
+		c.inflated = c.inflated[n:]
+		return n, nil
+	}
+	for c.recordLeft == 0 {
+		if err := c.readRecordHeader(); err != nil {
+			return 0, err
+		}
+	}
+	if len(c.pending) == 0 {
+		if err := c.fill(); err != nil {
+			return 0, unexpectedEOF(err)
+		}
+	}
+	n := copy(p, c.pending[:min(c.recordLeft, len(c.pending))])
+	c.pending = c.pending[n:]
+	c.recordLeft -= n
+	return n, nil
+}
+
+// fill reads the next message into pending. Empty messages are skipped, as they carry nothing for
+// a byte stream and a zero length read would look like EOF to io.Reader users.
+func (c *webrtcNetConn) fill() error {
+	if c.readBuf == nil {
+		c.readBuf = make([]byte, maxMessageSize)
+	}
+	for {
+		n, _, err := c.ReadWriteCloser.ReadDataChannel(c.readBuf)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+		c.pending = c.readBuf[:n]
+		return nil
+	}
+}
+
+func (c *webrtcNetConn) Reconnected() bool {
+	return c.reconnected
+}
+
+func (c *webrtcNetConn) PublicKey() ed25519.PublicKey {
+	return c.publicKey
+}
+
+func (c *webrtcNetConn) Capabilities() *PeerCapabilities {
+	return c.capabilities
 }
 
-func (c webrtcNetConn) LocalAddr() net.Addr {
+func (c *webrtcNetConn) LocalAddr() net.Addr {
 	return webrtcNetAddr{
-		peerIDBinary: c.PeerID,
+		peerID: c.PeerID,
 	}
 }
 
-func (c webrtcNetConn) RemoteAddr() net.Addr {
+func (c *webrtcNetConn) RemoteAddr() net.Addr {
 	return webrtcNetAddr{
-		peerIDBinary: c.PeerID,
+		peerID: c.PeerID,
 	}
 }
 
 // Do we need these for WebRTC connections exposed as net.Conns? Can we set them somewhere inside
 // PeerConnection or on the channel or some transport?
 
-func (c webrtcNetConn) SetDeadline(_ time.Time) error {
+func (c *webrtcNetConn) SetDeadline(_ time.Time) error {
 	return nil
 }
 
-func (c webrtcNetConn) SetReadDeadline(_ time.Time) error {
+func (c *webrtcNetConn) SetReadDeadline(_ time.Time) error {
 	return nil
 }
 
-func (c webrtcNetConn) SetWriteDeadline(_ time.Time) error {
+func (c *webrtcNetConn) SetWriteDeadline(_ time.Time) error {
 	return nil
 }
 
 type webrtcNetAddr struct {
-	peerIDBinary string
+	peerID PeerID
 }
 
 func (webrtcNetAddr) Network() string {
@@ -53,5 +205,5 @@ func (webrtcNetAddr) Network() string {
 }
 
 func (a webrtcNetAddr) String() string {
-	return base58.Encode([]byte(a.peerIDBinary))
+	return a.peerID.Base58()
 }
@@ -0,0 +1,105 @@
+package gop2pt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func streamConn(messages ...string) *webrtcNetConn {
+	mp := &messagePipe{}
+	for _, m := range messages {
+		mp.messages = append(mp.messages, []byte(m))
+	}
+	return &webrtcNetConn{ReadWriteCloser: mp, chunkSize: maxSendMessageSize}
+}
+
+func TestReadPartialMessage(t *testing.T) {
+	conn := streamConn("hello world", "next")
+	buf := make([]byte, 4)
+	var reads []string
+	for {
+		n, err := conn.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		reads = append(reads, string(buf[:n]))
+	}
+	// Reads never span messages, so each message ends with a short read.
+	want := []string{"hell", "o wo", "rld", "next"}
+	if len(reads) != len(want) {
+		t.Fatalf("reads %q, want %q", reads, want)
+	}
+	for i := range want {
+		if reads[i] != want[i] {
+			t.Fatalf("reads %q, want %q", reads, want)
+		}
+	}
+}
+
+func TestReadFullAcrossMessages(t *testing.T) {
+	conn := streamConn("ab", "", "cde", "f")
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "abcdef" {
+		t.Fatalf("read %q, want %q", buf, "abcdef")
+	}
+	if n, err := conn.Read(buf); err != io.EOF {
+		t.Fatalf("read %d bytes, %v after the stream ended, want EOF", n, err)
+	}
+}
+
+func TestReadBufferAllocatedOnDemand(t *testing.T) {
+	msg := bytes.Repeat([]byte{7}, 1000)
+	conn := streamConn(string(msg), string(msg))
+
+	// A buffer any message fits is read into directly.
+	big := make([]byte, maxMessageSize)
+	n, err := conn.Read(big)
+	if err != nil || !bytes.Equal(big[:n], msg) {
+		t.Fatalf("read %d bytes, %v, want the whole message", n, err)
+	}
+	if conn.readBuf != nil {
+		t.Fatal("read buffer allocated for a read that didn't need it")
+	}
+
+	small := make([]byte, 10)
+	if _, err := conn.Read(small); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.readBuf) != maxMessageSize {
+		t.Fatalf("read buffer is %d bytes, want %d", len(conn.readBuf), maxMessageSize)
+	}
+	rest, err := io.ReadAll(conn)
+	if err != nil || len(rest) != len(msg)-len(small) {
+		t.Fatalf("read %d more bytes, %v, want %d", len(rest), err, len(msg)-len(small))
+	}
+}
+
+func TestReadMessageTooLarge(t *testing.T) {
+	conn := streamConn(string(make([]byte, maxMessageSize+1)))
+	if _, err := conn.Read(make([]byte, 10)); !errors.Is(err, io.ErrShortBuffer) {
+		t.Fatalf("got error %v, want %v", err, io.ErrShortBuffer)
+	}
+}
+
+func TestWriteSplitsToChunkSize(t *testing.T) {
+	conn := streamConn()
+	conn.chunkSize = 4
+	if n, err := conn.Write([]byte("abcdefghij")); n != 10 || err != nil {
+		t.Fatalf("wrote %d bytes, %v", n, err)
+	}
+	got, err := io.ReadAll(conn)
+	if err != nil || string(got) != "abcdefghij" {
+		t.Fatalf("read back %q, %v", got, err)
+	}
+	if mp := conn.ReadWriteCloser.(*messagePipe); len(mp.messages) != 0 {
+		t.Fatalf("%d messages left unread", len(mp.messages))
+	}
+}
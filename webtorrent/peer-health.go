@@ -0,0 +1,286 @@
+package webtorrent
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/datachannel"
+	"github.com/pion/webrtc/v3"
+)
+
+var (
+	// ErrPeerConnectionFailed is returned from reads and writes once ICE or DTLS reports the peer
+	// connection as failed.
+	ErrPeerConnectionFailed = errors.New("peer connection failed")
+	// ErrPeerConnectionClosed is returned once the peer connection was closed underneath the data
+	// channel, for example by the remote.
+	ErrPeerConnectionClosed = errors.New("peer connection closed")
+	// ErrPeerDisconnected is returned when the peer connection stayed disconnected for longer than
+	// HealthConfig.DisconnectedTimeout.
+	ErrPeerDisconnected = errors.New("peer disconnected")
+	// ErrHeartbeatTimeout is returned when no heartbeat was received from the remote within
+	// HealthConfig.HeartbeatTimeout.
+	ErrHeartbeatTimeout = errors.New("peer heartbeat timed out")
+)
+
+// Recorded when the data channel is closed by us, so that it isn't reported as a failure.
+var errLocallyClosed = errors.New("closed locally")
+
+const heartbeatLabel = "gop2pt-heartbeat"
+
+// DefaultHeartbeatChannelID is the data channel ID reserved for heartbeats unless
+// HealthConfig.HeartbeatChannelID says otherwise. The channel is negotiated out of band so both
+// sides can open it without another offer/answer round, and the ID is well clear of the ones pion
+// hands out for the single signaled channel.
+const DefaultHeartbeatChannelID uint16 = 1023
+
+// HealthConfig controls how quickly a dead peer is detected on an open data channel. The zero
+// value only reacts to the peer connection reaching the failed or closed state.
+type HealthConfig struct {
+	// How long the peer connection may stay disconnected before the conn is failed. Zero waits
+	// for ICE to give up and report failed.
+	DisconnectedTimeout time.Duration
+	// Interval between heartbeats on a dedicated negotiated data channel. Zero disables
+	// heartbeats. Both peers must enable them, as a silent remote looks dead.
+	HeartbeatInterval time.Duration
+	// How long without a heartbeat before the conn is failed. Defaults to three intervals.
+	HeartbeatTimeout time.Duration
+	// The negotiated data channel ID heartbeats are sent on, reserved while heartbeats are
+	// enabled. Both peers must use the same one. Zero means DefaultHeartbeatChannelID.
+	HeartbeatChannelID uint16
+}
+
+func (hc HealthConfig) heartbeatChannelID() uint16 {
+	if hc.HeartbeatChannelID != 0 {
+		return hc.HeartbeatChannelID
+	}
+	return DefaultHeartbeatChannelID
+}
+
+func (hc HealthConfig) heartbeatTimeout() time.Duration {
+	if hc.HeartbeatTimeout > 0 {
+		return hc.HeartbeatTimeout
+	}
+	return 3 * hc.HeartbeatInterval
+}
+
+// monitoredDataChannel watches the owning PeerConnection and fails the data channel promptly
+// when the remote goes away, so blocked reads return a distinct error instead of hanging.
+type monitoredDataChannel struct {
+	datachannel.ReadWriteCloser
+
+	mu   sync.Mutex
+	err  error
+	done chan struct{}
+	// Whether the channel was handed out, see deliver. onClose is only called for delivered ones.
+	delivered bool
+	onClose   func(error)
+}
+
+func monitorDataChannel(
+	rwc datachannel.ReadWriteCloser,
+	pc *wrappedPeerConnection,
+	config HealthConfig,
+	onClose func(error),
+) *monitoredDataChannel {
+	m := &monitoredDataChannel{
+		ReadWriteCloser: rwc,
+		done:            make(chan struct{}),
+		onClose:         onClose,
+	}
+
+	var disconnected *time.Timer
+	onState := func(state webrtc.PeerConnectionState) {
+		m.mu.Lock()
+		if disconnected != nil {
+			disconnected.Stop()
+			disconnected = nil
+		}
+		m.mu.Unlock()
+
+		switch state {
+		case webrtc.PeerConnectionStateFailed:
+			m.fail(ErrPeerConnectionFailed)
+		case webrtc.PeerConnectionStateClosed:
+			m.fail(ErrPeerConnectionClosed)
+		case webrtc.PeerConnectionStateDisconnected:
+			if config.DisconnectedTimeout <= 0 {
+				return
+			}
+			m.mu.Lock()
+			disconnected = time.AfterFunc(config.DisconnectedTimeout, func() {
+				m.fail(ErrPeerDisconnected)
+			})
+			m.mu.Unlock()
+		}
+	}
+	pc.OnConnectionStateChange(onState)
+	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		switch state {
+		case webrtc.ICEConnectionStateFailed:
+			m.fail(ErrPeerConnectionFailed)
+		case webrtc.ICEConnectionStateClosed:
+			m.fail(ErrPeerConnectionClosed)
+		}
+	})
+	// The state may have changed before the handlers were registered.
+	onState(pc.ConnectionState())
+
+	if config.HeartbeatInterval > 0 {
+		if err := m.startHeartbeat(pc, config); err != nil {
+			m.fail(err)
+		}
+	}
+
+	return m
+}
+
+// deliver marks the channel as handed out, so that its closing is reported to onClose. It returns
+// false if the channel already failed, in which case it mustn't be handed out.
+func (m *monitoredDataChannel) deliver() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return false
+	}
+	m.delivered = true
+	return true
+}
+
+// fail records why the data channel died and tears down the peer connection, which unblocks any
+// pending reads. Only the first error is kept, and only the first call returns the error from
+// closing the channel.
+func (m *monitoredDataChannel) fail(err error) error {
+	m.mu.Lock()
+	if m.err != nil {
+		m.mu.Unlock()
+		return nil
+	}
+	m.err = err
+	close(m.done)
+	delivered := m.delivered
+	m.mu.Unlock()
+
+	closeErr := m.ReadWriteCloser.Close()
+	if err == errLocallyClosed {
+		err = nil
+	} else {
+		metrics.Add("peer connections lost", 1)
+	}
+	if delivered && m.onClose != nil {
+		m.onClose(err)
+	}
+	return closeErr
+}
+
+func (m *monitoredDataChannel) failure() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// translate replaces the generic error from a torn down channel with the reason it was failed.
+func (m *monitoredDataChannel) translate(err error) error {
+	if err == nil {
+		return nil
+	}
+	if reason := m.failure(); reason != nil && reason != errLocallyClosed {
+		return reason
+	}
+	return err
+}
+
+func (m *monitoredDataChannel) Read(p []byte) (int, error) {
+	n, err := m.ReadWriteCloser.Read(p)
+	return n, m.translate(err)
+}
+
+func (m *monitoredDataChannel) ReadDataChannel(p []byte) (int, bool, error) {
+	n, isString, err := m.ReadWriteCloser.ReadDataChannel(p)
+	return n, isString, m.translate(err)
+}
+
+func (m *monitoredDataChannel) Write(p []byte) (int, error) {
+	if err := m.failure(); err != nil && err != errLocallyClosed {
+		return 0, err
+	}
+	n, err := m.ReadWriteCloser.Write(p)
+	return n, m.translate(err)
+}
+
+func (m *monitoredDataChannel) WriteDataChannel(p []byte, isString bool) (int, error) {
+	if err := m.failure(); err != nil && err != errLocallyClosed {
+		return 0, err
+	}
+	n, err := m.ReadWriteCloser.WriteDataChannel(p, isString)
+	return n, m.translate(err)
+}
+
+func (m *monitoredDataChannel) Close() error {
+	return m.fail(errLocallyClosed)
+}
+
+func (m *monitoredDataChannel) startHeartbeat(pc *wrappedPeerConnection, config HealthConfig) error {
+	negotiated := true
+	id := config.heartbeatChannelID()
+	dc, err := pc.CreateDataChannel(heartbeatLabel, &webrtc.DataChannelInit{
+		Negotiated: &negotiated,
+		ID:         &id,
+	})
+	if err != nil {
+		return err
+	}
+	dc.OnOpen(func() {
+		raw, err := dc.Detach()
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		go m.runHeartbeat(raw, config)
+	})
+	return nil
+}
+
+func (m *monitoredDataChannel) runHeartbeat(hb datachannel.ReadWriteCloser, config HealthConfig) {
+	defer hb.Close()
+
+	var lastMu sync.Mutex
+	last := time.Now()
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			if _, err := hb.Read(buf); err != nil {
+				if err != io.EOF {
+					metrics.Add("heartbeat read errors", 1)
+				}
+				return
+			}
+			lastMu.Lock()
+			last = time.Now()
+			lastMu.Unlock()
+		}
+	}()
+
+	ticker := time.NewTicker(config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			lastMu.Lock()
+			silent := time.Since(last)
+			lastMu.Unlock()
+			if silent > config.heartbeatTimeout() {
+				metrics.Add("heartbeat timeouts", 1)
+				m.fail(ErrHeartbeatTimeout)
+				return
+			}
+			// A failed write means the remote is going away, which the next ticks will notice.
+			hb.Write([]byte{0})
+		case <-m.done:
+			return
+		}
+	}
+}
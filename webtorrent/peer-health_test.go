@@ -0,0 +1,153 @@
+package webtorrent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// monitoredEnd is one side of a connected pair of peer connections.
+type monitoredEnd struct {
+	pc      *wrappedPeerConnection
+	dc      *monitoredDataChannel
+	onClose chan error
+}
+
+// connectMonitored connects two peer connections over loopback and monitors the data channel on
+// each side with the given health config, delivering it unless deliver is false.
+func connectMonitored(t *testing.T, offerer, answerer HealthConfig, deliver bool) (a, b *monitoredEnd) {
+	t.Helper()
+	tr := NewTransport(NewSettingEngine(), webrtc.Configuration{}, PrivacyOff)
+	a = &monitoredEnd{onClose: make(chan error, 1)}
+	b = &monitoredEnd{onClose: make(chan error, 1)}
+	opened := make(chan struct{}, 2)
+	onOpen := func(end *monitoredEnd) func(*monitoredDataChannel) {
+		return func(dc *monitoredDataChannel) {
+			end.dc = dc
+			if deliver {
+				dc.deliver()
+			}
+			opened <- struct{}{}
+		}
+	}
+	onClose := func(end *monitoredEnd) func(error) {
+		return func(err error) { end.onClose <- err }
+	}
+
+	pc, dc, offer, err := tr.newOffer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.pc = pc
+	t.Cleanup(func() { a.pc.Close() })
+	b.pc, _, err = tr.newAnsweringPeerConnection(context.Background(), offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.pc.Close() })
+	b.pc.OnDataChannel(func(d *webrtc.DataChannel) {
+		setDataChannelOnOpen(d, b.pc, answerer, onClose(b), onOpen(b))
+	})
+	setDataChannelOnOpen(dc, a.pc, offerer, onClose(a), onOpen(a))
+	if err := a.pc.SetRemoteDescription(*b.pc.LocalDescription()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-opened:
+		case <-time.After(10 * time.Second):
+			t.Fatal("data channels didn't open")
+		}
+	}
+	return a, b
+}
+
+// readErr reads from end until it fails.
+func readErr(t *testing.T, end *monitoredEnd, timeout time.Duration) error {
+	t.Helper()
+	errs := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			if _, err := end.dc.Read(buf); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(timeout):
+		t.Fatal("read didn't fail")
+		return nil
+	}
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	// The answerer doesn't send heartbeats, so it looks dead to the offerer.
+	a, _ := connectMonitored(t, HealthConfig{HeartbeatInterval: 50 * time.Millisecond}, HealthConfig{}, true)
+	if err := readErr(t, a, 5*time.Second); !errors.Is(err, ErrHeartbeatTimeout) {
+		t.Fatalf("read failed with %v, want %v", err, ErrHeartbeatTimeout)
+	}
+	if err := <-a.onClose; !errors.Is(err, ErrHeartbeatTimeout) {
+		t.Fatalf("onClose got %v, want %v", err, ErrHeartbeatTimeout)
+	}
+}
+
+func TestHeartbeatKeepsConnAlive(t *testing.T) {
+	health := HealthConfig{HeartbeatInterval: 50 * time.Millisecond}
+	a, b := connectMonitored(t, health, health, true)
+	time.Sleep(500 * time.Millisecond)
+	if err := a.dc.failure(); err != nil {
+		t.Fatalf("offerer failed with %v while both sides send heartbeats", err)
+	}
+	if err := b.dc.failure(); err != nil {
+		t.Fatalf("answerer failed with %v while both sides send heartbeats", err)
+	}
+}
+
+func TestRemoteCloseDetected(t *testing.T) {
+	a, b := connectMonitored(t, HealthConfig{DisconnectedTimeout: 200 * time.Millisecond}, HealthConfig{}, true)
+	b.pc.Close()
+	select {
+	case err := <-a.onClose:
+		if !errors.Is(err, ErrPeerDisconnected) && !errors.Is(err, ErrPeerConnectionFailed) && !errors.Is(err, ErrPeerConnectionClosed) {
+			t.Fatalf("remote close reported as %v, want one of the peer connection errors", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("remote close not detected")
+	}
+	if _, err := a.dc.Write([]byte("x")); err == nil {
+		t.Fatal("write succeeded after the remote went away")
+	}
+}
+
+func TestLocalClose(t *testing.T) {
+	a, _ := connectMonitored(t, HealthConfig{}, HealthConfig{}, true)
+	if err := a.dc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-a.onClose; err != nil {
+		t.Fatalf("local close reported %v, want nil", err)
+	}
+	if a.dc.Close() != nil {
+		t.Fatal("second close returned an error")
+	}
+}
+
+func TestUndeliveredChannelNotReported(t *testing.T) {
+	a, _ := connectMonitored(t, HealthConfig{}, HealthConfig{}, false)
+	a.dc.Close()
+	select {
+	case err := <-a.onClose:
+		t.Fatalf("onClose called with %v for a channel that wasn't delivered", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if a.dc.deliver() {
+		t.Fatal("closed channel delivered")
+	}
+}
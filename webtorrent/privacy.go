@@ -0,0 +1,115 @@
+package webtorrent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// PrivacyMode controls which of our addresses are exposed in offers and answers, which are seen
+// by the tracker and random peers.
+type PrivacyMode int
+
+const (
+	// PrivacyOff advertises every gathered candidate, including local addresses.
+	PrivacyOff PrivacyMode = iota
+	// PrivacyMDNS hides host candidate addresses behind random mDNS names, as browsers do. Only
+	// peers on the same link can resolve them.
+	PrivacyMDNS
+	// PrivacySrflxOnly only advertises server reflexive candidates, i.e. our public address as
+	// seen by STUN servers, which must be configured. Host candidates are still gathered as the
+	// base of the reflexive ones, but behind mDNS names as with PrivacyMDNS, so their addresses
+	// reach neither the SDP nor peers probing them.
+	PrivacySrflxOnly
+	// PrivacyRelayOnly only gathers relay candidates, so peers never learn our address. TURN
+	// servers must be configured.
+	PrivacyRelayOnly
+)
+
+var (
+	ErrPrivateAddressExposed    = errors.New("local session description exposes a private address")
+	ErrNoAdvertisableCandidates = errors.New("no candidates left to advertise in privacy mode")
+)
+
+func (m PrivacyMode) configure(s *webrtc.SettingEngine, config *webrtc.Configuration) {
+	switch m {
+	case PrivacyMDNS, PrivacySrflxOnly:
+		enableMDNS(s)
+	case PrivacyRelayOnly:
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+}
+
+// sanitize strips what the mode doesn't allow from our own desc before it is sent, and verifies
+// that no raw private address is left in it.
+func (m PrivacyMode) sanitize(desc webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	if m == PrivacyOff {
+		return desc, nil
+	}
+
+	lines := strings.SplitAfter(desc.SDP, "\n")
+	kept := lines[:0]
+	candidates := 0
+	for _, line := range lines {
+		c, ok := parseCandidateLine(line)
+		if !ok {
+			if ip := connectionLineIP(line); isPrivateAddress(ip) {
+				return desc, fmt.Errorf("%w: %s", ErrPrivateAddressExposed, ip)
+			}
+			kept = append(kept, line)
+			continue
+		}
+		if m == PrivacySrflxOnly && c.typ != webrtc.ICECandidateTypeSrflx {
+			continue
+		}
+		if isPrivateAddress(c.ip) {
+			return desc, fmt.Errorf("%w: %s", ErrPrivateAddressExposed, c.ip)
+		}
+		candidates++
+		kept = append(kept, hideRelatedAddress(line))
+	}
+	if candidates == 0 {
+		return desc, ErrNoAdvertisableCandidates
+	}
+	return webrtc.SessionDescription{Type: desc.Type, SDP: strings.Join(kept, "")}, nil
+}
+
+// Carrier-grade NAT addresses (RFC 6598), which net.IP.IsPrivate doesn't cover.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPrivateAddress(ip net.IP) bool {
+	return ip != nil && (ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		sharedAddressSpace.Contains(ip))
+}
+
+// connectionLineIP returns the address of a "c=IN IP4 address" line.
+func connectionLineIP(line string) net.IP {
+	value := strings.TrimSpace(line)
+	if !strings.HasPrefix(value, "c=") {
+		return nil
+	}
+	fields := strings.Fields(strings.TrimPrefix(value, "c="))
+	if len(fields) < 3 {
+		return nil
+	}
+	return net.ParseIP(strings.SplitN(fields[2], "/", 2)[0])
+}
+
+// hideRelatedAddress blanks the raddr and rport of a candidate, which name the local address
+// behind reflexive and relay candidates. Browsers do the same.
+func hideRelatedAddress(line string) string {
+	body := strings.TrimRight(line, "\r\n")
+	fields := strings.Fields(body)
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "raddr":
+			fields[i+1] = "0.0.0.0"
+		case "rport":
+			fields[i+1] = "0"
+		}
+	}
+	return strings.Join(fields, " ") + line[len(body):]
+}
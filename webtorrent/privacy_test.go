@@ -0,0 +1,94 @@
+package webtorrent
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestIsPrivateAddress(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"10.1.2.3":      true,
+		"172.16.0.1":    true,
+		"192.168.1.2":   true,
+		"127.0.0.1":     true,
+		"169.254.10.1":  true,
+		"100.64.0.1":    true,
+		"100.127.255.1": true,
+		"100.128.0.1":   false,
+		"fd00::1":       true,
+		"fe80::1":       true,
+		"203.0.113.7":   false,
+		"2001:db8::1":   false,
+	} {
+		if got := isPrivateAddress(net.ParseIP(addr)); got != want {
+			t.Errorf("isPrivateAddress(%s) = %t, want %t", addr, got, want)
+		}
+	}
+}
+
+func TestPrivacySrflxOnlySanitize(t *testing.T) {
+	out, err := PrivacySrflxOnly.sanitize(testOffer(hostMDNS, hostPrivate, srflxPublic, relayPublic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testOffer(strings.Replace(srflxPublic, "rport 50004", "rport 0", 1))
+	if out.SDP != want.SDP {
+		t.Fatalf("got SDP\n%s\nwant\n%s", out.SDP, want.SDP)
+	}
+
+	if _, err := PrivacySrflxOnly.sanitize(testOffer(hostMDNS)); !errors.Is(err, ErrNoAdvertisableCandidates) {
+		t.Fatalf("got error %v, want %v", err, ErrNoAdvertisableCandidates)
+	}
+}
+
+func TestPrivacySanitizeRejectsSharedAddress(t *testing.T) {
+	cgnat := "7 1 udp 1694498815 100.64.12.34 50006 typ srflx raddr 0.0.0.0 rport 50006"
+	_, err := PrivacyMDNS.sanitize(testOffer(hostMDNS, cgnat))
+	if !errors.Is(err, ErrPrivateAddressExposed) {
+		t.Fatalf("got error %v, want %v", err, ErrPrivateAddressExposed)
+	}
+}
+
+func TestPrivacyHidesRelatedAddress(t *testing.T) {
+	srflx := "5 1 udp 1694498815 203.0.113.7 50004 typ srflx raddr 192.168.1.2 rport 50000"
+	out, err := PrivacyMDNS.sanitize(testOffer(srflx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.SDP, "192.168.1.2") {
+		t.Fatalf("related address left in SDP:\n%s", out.SDP)
+	}
+}
+
+// Host candidates must be gathered behind mDNS names, not just left out of the SDP, as peers can
+// otherwise still learn their addresses from ICE.
+func TestPrivacySrflxOnlyGathersHostCandidatesBehindMDNS(t *testing.T) {
+	tr := NewTransport(NewSettingEngine(), webrtc.Configuration{}, PrivacySrflxOnly)
+	pc, err := tr.newPeerConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	if _, err := pc.CreateDataChannel("test", nil); err != nil {
+		t.Fatal(err)
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc.PeerConnection)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	for _, line := range strings.Split(pc.LocalDescription().SDP, "\n") {
+		c, ok := parseCandidateLine(line)
+		if ok && c.typ == webrtc.ICECandidateTypeHost && c.ip != nil {
+			t.Errorf("host candidate with a raw address gathered: %s", line)
+		}
+	}
+}
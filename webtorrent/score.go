@@ -0,0 +1,103 @@
+package webtorrent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/DaniilSokolyuk/gop2pt/event"
+)
+
+// How many recent times to answer the median is taken over.
+const maxAnswerTimes = 64
+
+// Events counted in TrackerClientStats.Failures.
+var failureEvents = map[event.Type]bool{
+	event.TrackerConnectFailed: true,
+	event.TrackerDisconnected:  true,
+	event.AnnounceFailed:       true,
+	event.OfferTimedOut:        true,
+	event.AnswerTimedOut:       true,
+	event.SignalingFailed:      true,
+}
+
+// Errors of failure events that don't carry one.
+var failureEventErrs = map[event.Type]error{
+	event.OfferTimedOut:  errOfferTimedOut,
+	event.AnswerTimedOut: errAnswerTimedOut,
+}
+
+// Reasons counted in TrackerClientStats.FailureReasons.
+const (
+	ReasonDial          = "dial"
+	ReasonWebsocket     = "websocket"
+	ReasonTimeout       = "timeout"
+	ReasonNotConnected  = "not connected"
+	ReasonOfferTimedOut = "offer timed out"
+	ReasonNoDataChannel = "data channel not opened"
+	ReasonSignature     = "signature"
+	ReasonSDPPolicy     = "sdp policy"
+	ReasonPrivacy       = "privacy"
+	ReasonPeerConn      = "peer connection"
+	ReasonOther         = "other"
+)
+
+// failureReason sorts err into one of the Reason constants.
+func failureReason(err error) string {
+	var (
+		netErr   net.Error
+		opErr    *net.OpError
+		closeErr *websocket.CloseError
+	)
+	switch {
+	case errors.Is(err, ErrNotConnected):
+		return ReasonNotConnected
+	case errors.Is(err, errOfferTimedOut):
+		return ReasonOfferTimedOut
+	case errors.Is(err, errAnswerTimedOut):
+		return ReasonNoDataChannel
+	case errors.Is(err, ErrSDPUnsigned), errors.Is(err, ErrSDPBadSignature):
+		return ReasonSignature
+	case errors.Is(err, ErrSDPTooLarge), errors.Is(err, ErrSDPNoDataChannel),
+		errors.Is(err, ErrSDPNoCandidates), errors.Is(err, ErrSDPRelayOnly), errors.Is(err, ErrNoFingerprint):
+		return ReasonSDPPolicy
+	case errors.Is(err, ErrPrivateAddressExposed), errors.Is(err, ErrNoAdvertisableCandidates):
+		return ReasonPrivacy
+	case errors.Is(err, ErrPeerConnectionFailed), errors.Is(err, ErrPeerConnectionClosed):
+		return ReasonPeerConn
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ReasonTimeout
+	case errors.Is(err, websocket.ErrBadHandshake), errors.As(err, &closeErr):
+		return ReasonWebsocket
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return ReasonDial
+	}
+	return ReasonOther
+}
+
+// score multiplies the share of dials that connected by the share of offers that were answered,
+// discounted by how much of the offer timeout answers take. Both shares start out at one half
+// rather than zero, so that a tracker we know nothing about yet isn't written off.
+func (s TrackerClientStats) score() float64 {
+	connected := s.Dials - s.Failures[event.TrackerConnectFailed]
+	connectRate := float64(connected+1) / float64(s.Dials+2)
+	answerRate := float64(s.OffersAnswered+1) / float64(s.OffersSent+2)
+	speed := 1 - float64(s.MedianTimeToAnswer)/float64(offerTimeOut)
+	if speed < 0 {
+		speed = 0
+	}
+	return connectRate * answerRate * speed
+}
+
+func median(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,88 @@
+package webtorrent
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/DaniilSokolyuk/gop2pt/event"
+)
+
+func TestFailureReason(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("announcing: %w", ErrNotConnected), ReasonNotConnected},
+		{errOfferTimedOut, ReasonOfferTimedOut},
+		{errAnswerTimedOut, ReasonNoDataChannel},
+		{fmt.Errorf("offer: %w", ErrSDPBadSignature), ReasonSignature},
+		{fmt.Errorf("offer: %w", ErrSDPRelayOnly), ReasonSDPPolicy},
+		{ErrPrivateAddressExposed, ReasonPrivacy},
+		{ErrPeerConnectionFailed, ReasonPeerConn},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, ReasonDial},
+		{&net.OpError{Op: "read", Err: timeoutError{}}, ReasonTimeout},
+		{websocket.ErrBadHandshake, ReasonWebsocket},
+		{fmt.Errorf("read message error: %w", &websocket.CloseError{Code: websocket.CloseGoingAway}), ReasonWebsocket},
+		{errors.New("something else"), ReasonOther},
+	} {
+		if got := failureReason(tc.err); got != tc.want {
+			t.Errorf("failureReason(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestStatsFailureReasons(t *testing.T) {
+	tc := &TrackerClient{}
+	dialErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	tc.emit(event.Event{Type: event.TrackerConnectFailed, Err: dialErr})
+	tc.emit(event.Event{Type: event.TrackerConnectFailed, Err: dialErr})
+	tc.emit(event.Event{Type: event.OfferReceived})
+	tc.emit(event.Event{Type: event.OfferTimedOut})
+
+	stats := tc.Stats()
+	if stats.Failures[event.TrackerConnectFailed] != 2 || stats.Failures[event.OfferTimedOut] != 1 {
+		t.Errorf("failures %v", stats.Failures)
+	}
+	want := map[string]int64{ReasonDial: 2, ReasonOfferTimedOut: 1}
+	if fmt.Sprint(stats.FailureReasons) != fmt.Sprint(want) {
+		t.Errorf("failure reasons %v, want %v", stats.FailureReasons, want)
+	}
+	if !errors.Is(stats.LastError, errOfferTimedOut) || stats.LastErrorTime.IsZero() {
+		t.Errorf("last error %v at %v, want %v", stats.LastError, stats.LastErrorTime, errOfferTimedOut)
+	}
+
+	stats.FailureReasons[ReasonDial] = 0
+	if tc.Stats().FailureReasons[ReasonDial] != 2 {
+		t.Error("Stats shares its FailureReasons with the client")
+	}
+}
+
+func TestScore(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		stats TrackerClientStats
+		want  float64
+	}{
+		{"unknown tracker", TrackerClientStats{}, 0.25},
+		{"reliable", TrackerClientStats{Dials: 8, OffersSent: 8, OffersAnswered: 8}, 0.81},
+		{"every dial failed", TrackerClientStats{Dials: 8, Failures: map[event.Type]int64{event.TrackerConnectFailed: 8}}, 0.05},
+		{"no answers", TrackerClientStats{Dials: 1, OffersSent: 18}, 2.0 / 3 / 20},
+		{"slow answers", TrackerClientStats{MedianTimeToAnswer: offerTimeOut / 2}, 0.125},
+		{"answers after the timeout", TrackerClientStats{MedianTimeToAnswer: 2 * offerTimeOut}, 0},
+	} {
+		if got := tc.stats.score(); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s: score %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package webtorrent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const defaultMaxSDPSize = 32 * 1024
+
+var (
+	ErrSDPTooLarge      = errors.New("session description too large")
+	ErrSDPNoDataChannel = errors.New("session description has no data channel media section")
+	ErrSDPNoCandidates  = errors.New("session description has no acceptable candidates")
+	ErrSDPRelayOnly     = errors.New("session description only offers relay candidates")
+)
+
+// SDPPolicy validates offers and answers received from peers before they are handed to pion, and
+// filters out candidates we don't want to connect to. Descriptions must always carry a DTLS
+// fingerprint and a data channel media section. The zero SDPPolicy only enforces that and the
+// default size limit; it applies to every TrackerClient without a policy of its own.
+type SDPPolicy struct {
+	// Maximum size of the SDP in bytes. Defaults to 32 KiB, negative means no limit.
+	MaxSize int
+	// Candidate types to drop, for example webrtc.ICECandidateTypeHost.
+	DropCandidateTypes []webrtc.ICECandidateType
+	// Drop candidates with private (RFC 1918 and unique local), link-local or loopback addresses.
+	DropPrivate   bool
+	DropLinkLocal bool
+	DropLoopback  bool
+	// Reject peers whose candidates are all relayed.
+	RejectRelayOnly bool
+}
+
+// apply validates desc and returns it with unwanted candidates removed, along with how many were
+// dropped.
+func (sp SDPPolicy) apply(desc webrtc.SessionDescription) (webrtc.SessionDescription, int, error) {
+	maxSize := sp.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultMaxSDPSize
+	}
+	if maxSize > 0 && len(desc.SDP) > maxSize {
+		return desc, 0, fmt.Errorf("%w: %d bytes", ErrSDPTooLarge, len(desc.SDP))
+	}
+	if _, err := Fingerprint(desc); err != nil {
+		return desc, 0, err
+	}
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return desc, 0, fmt.Errorf("parsing session description: %w", err)
+	}
+	hasDataChannel := false
+	for _, media := range parsed.MediaDescriptions {
+		if media.MediaName.Media == "application" {
+			hasDataChannel = true
+		}
+	}
+	if !hasDataChannel {
+		return desc, 0, ErrSDPNoDataChannel
+	}
+
+	lines := strings.SplitAfter(desc.SDP, "\n")
+	kept := lines[:0]
+	total, dropped, relayed := 0, 0, 0
+	for _, line := range lines {
+		c, ok := parseCandidateLine(line)
+		if !ok {
+			kept = append(kept, line)
+			continue
+		}
+		total++
+		if sp.dropCandidate(c) {
+			dropped++
+			continue
+		}
+		if c.typ == webrtc.ICECandidateTypeRelay {
+			relayed++
+		}
+		kept = append(kept, line)
+	}
+	if total > 0 && dropped == total {
+		return desc, dropped, ErrSDPNoCandidates
+	}
+	if sp.RejectRelayOnly && total > dropped && relayed == total-dropped {
+		return desc, dropped, ErrSDPRelayOnly
+	}
+	if dropped == 0 {
+		return desc, 0, nil
+	}
+	return webrtc.SessionDescription{Type: desc.Type, SDP: strings.Join(kept, "")}, dropped, nil
+}
+
+func (sp SDPPolicy) dropCandidate(c sdpCandidate) bool {
+	for _, typ := range sp.DropCandidateTypes {
+		if c.typ == typ {
+			return true
+		}
+	}
+	// Anything that isn't a literal address, such as an mDNS name, can't be classified here.
+	if c.ip == nil {
+		return false
+	}
+	return sp.DropPrivate && c.ip.IsPrivate() ||
+		sp.DropLinkLocal && (c.ip.IsLinkLocalUnicast() || c.ip.IsLinkLocalMulticast()) ||
+		sp.DropLoopback && c.ip.IsLoopback()
+}
+
+type sdpCandidate struct {
+	typ webrtc.ICECandidateType
+	ip  net.IP
+}
+
+// parseCandidateLine picks the address and type out of an "a=candidate:" line, which looks like
+// "a=candidate:foundation component transport priority address port typ type ...".
+func parseCandidateLine(line string) (sdpCandidate, bool) {
+	value := strings.TrimSpace(line)
+	if !strings.HasPrefix(value, "a=candidate:") {
+		return sdpCandidate{}, false
+	}
+	fields := strings.Fields(strings.TrimPrefix(value, "a=candidate:"))
+	if len(fields) < 8 || fields[6] != "typ" {
+		// Keep what we don't understand and let pion decide.
+		return sdpCandidate{}, false
+	}
+	typ, err := webrtc.NewICECandidateType(fields[7])
+	if err != nil {
+		return sdpCandidate{}, false
+	}
+	return sdpCandidate{typ: typ, ip: net.ParseIP(fields[4])}, true
+}
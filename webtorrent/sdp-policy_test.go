@@ -0,0 +1,168 @@
+package webtorrent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+const testSDPHeader = "v=0\r\n" +
+	"o=- 1 2 IN IP4 0.0.0.0\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"a=fingerprint:sha-256 AA:BB:CC:DD:EE:FF:00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33:44:55:66:77:88:99\r\n" +
+	"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=mid:0\r\n" +
+	"a=sctp-port:5000\r\n"
+
+func testOffer(candidates ...string) webrtc.SessionDescription {
+	sdp := testSDPHeader
+	for _, c := range candidates {
+		sdp += "a=candidate:" + c + "\r\n"
+	}
+	return webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdp}
+}
+
+const (
+	hostPrivate   = "1 1 udp 2130706431 192.168.1.2 50000 typ host"
+	hostLinkLocal = "2 1 udp 2130706431 169.254.10.1 50001 typ host"
+	hostLoopback  = "3 1 udp 2130706431 127.0.0.1 50002 typ host"
+	hostMDNS      = "4 1 udp 2130706431 0b9f3c1e-1f1d-4c3e-9f0e-8a6f0c2d1e3f.local 50003 typ host"
+	srflxPublic   = "5 1 udp 1694498815 203.0.113.7 50004 typ srflx raddr 0.0.0.0 rport 50004"
+	relayPublic   = "6 1 udp 16777215 198.51.100.9 3478 typ relay raddr 0.0.0.0 rport 50005"
+)
+
+func TestSDPPolicyFiltersCandidates(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		policy  SDPPolicy
+		in      []string
+		kept    []string
+		dropped int
+	}{
+		{
+			name: "zero policy keeps everything",
+			in:   []string{hostPrivate, hostLoopback, srflxPublic, relayPublic},
+			kept: []string{hostPrivate, hostLoopback, srflxPublic, relayPublic},
+		},
+		{
+			name:    "private, link-local and loopback",
+			policy:  SDPPolicy{DropPrivate: true, DropLinkLocal: true, DropLoopback: true},
+			in:      []string{hostPrivate, hostLinkLocal, hostLoopback, hostMDNS, srflxPublic},
+			kept:    []string{hostMDNS, srflxPublic},
+			dropped: 3,
+		},
+		{
+			name:    "by type",
+			policy:  SDPPolicy{DropCandidateTypes: []webrtc.ICECandidateType{webrtc.ICECandidateTypeHost}},
+			in:      []string{hostPrivate, hostMDNS, srflxPublic, relayPublic},
+			kept:    []string{srflxPublic, relayPublic},
+			dropped: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, dropped, err := tc.policy.apply(testOffer(tc.in...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dropped != tc.dropped {
+				t.Errorf("dropped %d candidates, want %d", dropped, tc.dropped)
+			}
+			want := testOffer(tc.kept...)
+			if out.SDP != want.SDP {
+				t.Errorf("got SDP\n%s\nwant\n%s", out.SDP, want.SDP)
+			}
+		})
+	}
+}
+
+func TestSDPPolicyRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy SDPPolicy
+		desc   webrtc.SessionDescription
+		err    error
+	}{
+		{
+			name:   "too large",
+			policy: SDPPolicy{MaxSize: 100},
+			desc:   testOffer(hostPrivate),
+			err:    ErrSDPTooLarge,
+		},
+		{
+			name:   "every candidate dropped",
+			policy: SDPPolicy{DropPrivate: true},
+			desc:   testOffer(hostPrivate),
+			err:    ErrSDPNoCandidates,
+		},
+		{
+			name:   "relay only",
+			policy: SDPPolicy{RejectRelayOnly: true, DropPrivate: true},
+			desc:   testOffer(hostPrivate, relayPublic),
+			err:    ErrSDPRelayOnly,
+		},
+		{
+			name: "no data channel",
+			desc: webrtc.SessionDescription{
+				Type: webrtc.SDPTypeOffer,
+				SDP:  strings.Replace(testSDPHeader, "m=application 9 UDP/DTLS/SCTP webrtc-datachannel", "m=audio 9 UDP/TLS/RTP/SAVPF 111", 1),
+			},
+			err: ErrSDPNoDataChannel,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := tc.policy.apply(tc.desc)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestSDPPolicyRequiresFingerprint(t *testing.T) {
+	desc := testOffer(srflxPublic)
+	desc.SDP = strings.Replace(desc.SDP, "a=fingerprint:", "a=x-fingerprint:", 1)
+	if _, _, err := (SDPPolicy{}).apply(desc); err == nil {
+		t.Fatal("accepted a description without a DTLS fingerprint")
+	}
+}
+
+func TestCheckSDPWithoutPolicy(t *testing.T) {
+	tc := &TrackerClient{}
+	for _, desc := range []webrtc.SessionDescription{
+		{Type: webrtc.SDPTypeOffer, SDP: "not even SDP"},
+		{Type: webrtc.SDPTypeOffer, SDP: strings.Replace(testSDPHeader, "a=fingerprint:", "a=x-fingerprint:", 1)},
+		{Type: webrtc.SDPTypeOffer, SDP: testSDPHeader[:strings.Index(testSDPHeader, "m=")]},
+		{Type: webrtc.SDPTypeAnswer, SDP: testOffer(strings.Repeat(srflxPublic+"\r\na=candidate:", 400) + srflxPublic).SDP},
+	} {
+		if _, err := tc.checkSDP(desc, utils.PeerID{}); err == nil {
+			t.Errorf("checkSDP without a policy accepted %.40q", desc.SDP)
+		}
+	}
+	if got := tc.Stats().RejectedOffers; got != 3 {
+		t.Errorf("counted %d rejected offers, want 3", got)
+	}
+
+	desc := testOffer(hostPrivate, srflxPublic)
+	out, err := tc.checkSDP(desc, utils.PeerID{})
+	if err != nil || out.SDP != desc.SDP {
+		t.Fatalf("checkSDP without a policy changed a valid description: %v", err)
+	}
+}
+
+func TestSDPPolicyLoosensSizeLimit(t *testing.T) {
+	desc := testOffer(strings.Repeat(srflxPublic+"\r\na=candidate:", 400) + srflxPublic)
+	if _, _, err := (SDPPolicy{}).apply(desc); !errors.Is(err, ErrSDPTooLarge) {
+		t.Fatalf("got error %v, want %v", err, ErrSDPTooLarge)
+	}
+	for _, policy := range []SDPPolicy{{MaxSize: 1 << 20}, {MaxSize: -1}} {
+		if _, _, err := policy.apply(desc); err != nil {
+			t.Errorf("policy with MaxSize %d rejected a %d byte description: %v", policy.MaxSize, len(desc.SDP), err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package webtorrent
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/DaniilSokolyuk/gop2pt/identity"
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+const sdpSignatureContext = "gop2pt sdp v1"
+
+var (
+	ErrSDPUnsigned     = errors.New("session description is not signed")
+	ErrSDPBadSignature = errors.New("session description signature does not match sender")
+)
+
+// SDPSigner signs outgoing offers and answers. *identity.Identity implements it.
+type SDPSigner interface {
+	PublicKey() ed25519.PublicKey
+	Sign(message []byte) []byte
+}
+
+// sdpSignedMessage covers everything a tracker could tamper with to redirect the connection: the
+// description itself and who it claims to come from, for which swarm and offer.
+func sdpSignedMessage(desc webrtc.SessionDescription, infoHash utils.InfoHash, peerId utils.PeerID, offerId string) []byte {
+	var b bytes.Buffer
+	b.WriteString(sdpSignatureContext)
+	b.WriteByte(0)
+	b.WriteString(desc.Type.String())
+	b.WriteByte(0)
+	b.Write(infoHash[:])
+	b.Write(peerId[:])
+	b.Write(utils.JsonStringToBinary(offerId))
+	b.WriteString(desc.SDP)
+	return b.Bytes()
+}
+
+// signSDP wraps desc for the tracker, signing it if a signer is configured.
+func (tc *TrackerClient) signSDP(desc webrtc.SessionDescription, infoHash utils.InfoHash, offerId string) SessionDescription {
+	signed := SessionDescription{SessionDescription: desc}
+	if tc.Signer != nil {
+		signed.Signature = &SDPSignature{
+			PublicKey: tc.Signer.PublicKey(),
+			Signature: tc.Signer.Sign(sdpSignedMessage(desc, infoHash, tc.PeerId, offerId)),
+		}
+	}
+	return signed
+}
+
+// verifySDP checks that desc was signed by the owner of peerId. Unsigned descriptions are only
+// rejected if RequireSignedSDP is set, but a signature that is present must be valid.
+func (tc *TrackerClient) verifySDP(desc SessionDescription, infoHash utils.InfoHash, peerId utils.PeerID, offerId string) error {
+	sig := desc.Signature
+	if sig == nil {
+		if tc.RequireSignedSDP {
+			return ErrSDPUnsigned
+		}
+		return nil
+	}
+	pub := ed25519.PublicKey(sig.PublicKey)
+	if len(pub) != ed25519.PublicKeySize {
+		return ErrSDPBadSignature
+	}
+	if identity.PeerIDFromPublicKey(pub) != peerId {
+		return ErrSDPBadSignature
+	}
+	message := sdpSignedMessage(desc.SessionDescription, infoHash, peerId, offerId)
+	if !identity.Verify(pub, message, sig.Signature) {
+		return ErrSDPBadSignature
+	}
+	return nil
+}
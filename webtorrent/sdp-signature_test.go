@@ -0,0 +1,91 @@
+package webtorrent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/DaniilSokolyuk/gop2pt/identity"
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+const testSignedSDP = "v=0\r\no=- 0 0 IN IP4 0.0.0.0\r\ns=-\r\nt=0 0\r\na=fingerprint:sha-256 AA:AA:AA:AA\r\n"
+
+func newSigner(t *testing.T) (*TrackerClient, *identity.Identity) {
+	t.Helper()
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &TrackerClient{PeerId: id.PeerID(), Signer: id}, id
+}
+
+func TestSDPSignature(t *testing.T) {
+	sender, id := newSigner(t)
+	other, _ := newSigner(t)
+	infoHash := utils.MakeInfoHash("signed")
+	offerID := strings.Repeat("o", 20)
+	desc := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testSignedSDP}
+	signed := sender.signSDP(desc, infoHash, offerID)
+
+	for _, tc := range []struct {
+		name     string
+		desc     SessionDescription
+		infoHash utils.InfoHash
+		peerID   utils.PeerID
+		offerID  string
+		want     error
+	}{
+		{"valid", signed, infoHash, id.PeerID(), offerID, nil},
+		{"tampered SDP", func() SessionDescription {
+			d := signed
+			d.SDP = strings.Replace(d.SDP, "AA:AA:AA:AA", "CC:CC:CC:CC", 1)
+			return d
+		}(), infoHash, id.PeerID(), offerID, ErrSDPBadSignature},
+		{"offer passed off as answer", func() SessionDescription {
+			d := signed
+			d.Type = webrtc.SDPTypeAnswer
+			return d
+		}(), infoHash, id.PeerID(), offerID, ErrSDPBadSignature},
+		{"other swarm", signed, utils.MakeInfoHash("other"), id.PeerID(), offerID, ErrSDPBadSignature},
+		{"other offer", signed, infoHash, id.PeerID(), strings.Repeat("x", 20), ErrSDPBadSignature},
+		{"claimed by another peer", signed, infoHash, other.PeerId, offerID, ErrSDPBadSignature},
+		{"signed by another key", other.signSDP(desc, infoHash, offerID), infoHash, id.PeerID(), offerID, ErrSDPBadSignature},
+		{"bad public key", func() SessionDescription {
+			d := signed
+			d.Signature = &SDPSignature{PublicKey: d.Signature.PublicKey[:10], Signature: d.Signature.Signature}
+			return d
+		}(), infoHash, id.PeerID(), offerID, ErrSDPBadSignature},
+		{"unsigned", SessionDescription{SessionDescription: desc}, infoHash, id.PeerID(), offerID, ErrSDPUnsigned},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			verifier := &TrackerClient{RequireSignedSDP: true}
+			if err := verifier.verifySDP(tc.desc, tc.infoHash, tc.peerID, tc.offerID); !errors.Is(err, tc.want) {
+				t.Fatalf("got error %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestSDPSignatureOptional(t *testing.T) {
+	sender, id := newSigner(t)
+	infoHash := utils.MakeInfoHash("signed")
+	offerID := strings.Repeat("o", 20)
+	desc := webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: testSignedSDP}
+	verifier := &TrackerClient{}
+
+	if err := verifier.verifySDP(SessionDescription{SessionDescription: desc}, infoHash, id.PeerID(), offerID); err != nil {
+		t.Fatalf("unsigned description rejected without RequireSignedSDP: %v", err)
+	}
+	// A signature that is present is checked regardless.
+	signed := sender.signSDP(desc, infoHash, offerID)
+	signed.SDP += "a=tampered\r\n"
+	if err := verifier.verifySDP(signed, infoHash, id.PeerID(), offerID); !errors.Is(err, ErrSDPBadSignature) {
+		t.Fatalf("got error %v, want %v", err, ErrSDPBadSignature)
+	}
+	if unsigned := (&TrackerClient{}).signSDP(desc, infoHash, offerID); unsigned.Signature != nil {
+		t.Fatal("description signed without a signer")
+	}
+}
@@ -0,0 +1,64 @@
+package webtorrent
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+var ErrNoFingerprint = errors.New("session description has no DTLS fingerprint")
+
+// Fingerprint returns the DTLS certificate fingerprint advertised in desc, as "algorithm value"
+// with the value lower-cased. A session level fingerprint takes precedence over media level ones.
+func Fingerprint(desc webrtc.SessionDescription) (string, error) {
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return "", err
+	}
+	if value, ok := parsed.Attribute("fingerprint"); ok {
+		return normalizeFingerprint(value), nil
+	}
+	for _, media := range parsed.MediaDescriptions {
+		if value, ok := media.Attribute("fingerprint"); ok {
+			return normalizeFingerprint(value), nil
+		}
+	}
+	return "", ErrNoFingerprint
+}
+
+// The max-message-size peers must assume when a description doesn't specify one, per RFC 8841.
+const DefaultMaxMessageSize = 65536
+
+// MaxMessageSize returns the largest data channel message the sender of desc accepts, or 0 if it
+// has no limit.
+func MaxMessageSize(desc webrtc.SessionDescription) int {
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return DefaultMaxMessageSize
+	}
+	for _, media := range parsed.MediaDescriptions {
+		if media.MediaName.Media != "application" {
+			continue
+		}
+		value, ok := media.Attribute("max-message-size")
+		if !ok {
+			break
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || size < 0 {
+			break
+		}
+		return size
+	}
+	return DefaultMaxMessageSize
+}
+
+func normalizeFingerprint(value string) string {
+	parts := strings.Fields(value)
+	if len(parts) != 2 {
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+	return strings.ToLower(parts[0]) + " " + strings.ToLower(parts[1])
+}
@@ -0,0 +1,457 @@
+// Package server implements a WebTorrent tracker, the websocket signaling server that
+// webtorrent.TrackerClient talks to. Peers announce offers for an info hash, the tracker hands
+// each offer to a random other peer in the swarm, or to the peer it is addressed to, and routes
+// the answer back by peer id.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DaniilSokolyuk/gop2pt/log"
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultInterval  = 2 * time.Minute
+	defaultMaxOffers = 10
+)
+
+var (
+	metrics = expvar.NewMap("webtorrent-server")
+
+	ErrServerClosed = errors.New("server closed")
+
+	// A message from a client we can't act on. It is skipped, keeping the socket open.
+	errMalformedMessage = errors.New("malformed message")
+)
+
+// Server is a WebTorrent tracker. It is an http.Handler that upgrades requests to websockets, so
+// it can be mounted at any path. The zero value is ready to use.
+type Server struct {
+	// The announce interval sent to clients. Defaults to 2 minutes.
+	Interval time.Duration
+	// Peers that haven't announced for this long are dropped from their swarms. Defaults to three
+	// intervals. Peers are also dropped when their websocket closes.
+	PeerTimeout time.Duration
+	// The most offers taken from a single announce. Defaults to 10.
+	MaxOffers int
+	// Upgrades incoming requests. The zero value accepts every origin.
+	Upgrader websocket.Upgrader
+	// Optional.
+	Logger log.Logger
+
+	mu       sync.Mutex
+	swarms   map[utils.InfoHash]*swarm
+	sockets  map[*socket]struct{}
+	closed   bool
+	reapOnce sync.Once
+	done     chan struct{}
+}
+
+type swarm struct {
+	peers      map[utils.PeerID]*peer
+	downloaded int
+}
+
+type peer struct {
+	socket   *socket
+	complete bool
+	lastSeen time.Time
+}
+
+// socket is one client websocket. A client may announce several info hashes and peer ids on it.
+type socket struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	// The swarms this socket joined, to the peer id used in each.
+	joined map[utils.InfoHash]utils.PeerID
+}
+
+func (s *socket) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// The messages clients send: announces with offers, answers to offers, and scrapes.
+type request struct {
+	webtorrent.AnnounceRequest
+	Answer  *webtorrent.SessionDescription `json:"answer"`
+	OfferID string                         `json:"offer_id"`
+}
+
+type scrapeRequest struct {
+	Action string `json:"action"`
+	// A single info hash, a list of them, or absent for every swarm.
+	InfoHash json.RawMessage `json:"info_hash"`
+}
+
+type ScrapeResponse struct {
+	Action string                `json:"action"`
+	Files  map[string]ScrapeFile `json:"files"`
+}
+
+type ScrapeFile struct {
+	Complete   int `json:"complete"`
+	Incomplete int `json:"incomplete"`
+	Downloaded int `json:"downloaded"`
+}
+
+func (srv *Server) interval() time.Duration {
+	if srv.Interval > 0 {
+		return srv.Interval
+	}
+	return defaultInterval
+}
+
+func (srv *Server) peerTimeout() time.Duration {
+	if srv.PeerTimeout > 0 {
+		return srv.PeerTimeout
+	}
+	return 3 * srv.interval()
+}
+
+func (srv *Server) maxOffers() int {
+	if srv.MaxOffers > 0 {
+		return srv.MaxOffers
+	}
+	return defaultMaxOffers
+}
+
+func (srv *Server) debug(msg string, keysAndValues ...interface{}) {
+	if srv.Logger != nil {
+		srv.Logger.Debug(msg, keysAndValues...)
+	}
+}
+
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := srv.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		srv.debug("websocket upgrade failed", log.KeyAddr, r.RemoteAddr, log.KeyError, err)
+		return
+	}
+	s := &socket{conn: conn, joined: make(map[utils.InfoHash]utils.PeerID)}
+
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		conn.Close()
+		return
+	}
+	if srv.sockets == nil {
+		srv.sockets = make(map[*socket]struct{})
+		srv.swarms = make(map[utils.InfoHash]*swarm)
+		srv.done = make(chan struct{})
+	}
+	srv.sockets[s] = struct{}{}
+	srv.mu.Unlock()
+	srv.reapOnce.Do(func() { go srv.reap() })
+	metrics.Add("websockets accepted", 1)
+
+	err = srv.readLoop(s)
+	srv.debug("websocket ended", log.KeyAddr, r.RemoteAddr, log.KeyError, err)
+
+	srv.mu.Lock()
+	delete(srv.sockets, s)
+	for infoHash, peerID := range s.joined {
+		srv.removePeer(s, infoHash, peerID)
+	}
+	srv.mu.Unlock()
+	conn.Close()
+}
+
+// readLoop handles messages from s until it fails. Messages that are malformed or have an unknown
+// action are skipped, as the reference bittorrent-tracker does, rather than dropping the client.
+func (srv *Server) readLoop(s *socket) error {
+	for {
+		_, message, err := s.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		err = srv.handleMessage(s, message)
+		if errors.Is(err, errMalformedMessage) {
+			metrics.Add("malformed messages", 1)
+			srv.debug("ignoring malformed message", log.KeyAddr, s.conn.RemoteAddr().String(), log.KeyError, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (srv *Server) handleMessage(s *socket, message []byte) error {
+	var action struct {
+		Action string `json:"action"`
+	}
+	if err := json.Unmarshal(message, &action); err != nil {
+		return fmt.Errorf("%w: %v", errMalformedMessage, err)
+	}
+	switch action.Action {
+	case "announce":
+		var req request
+		if err := json.Unmarshal(message, &req); err != nil {
+			return fmt.Errorf("%w: %v", errMalformedMessage, err)
+		}
+		return srv.handleAnnounce(s, req)
+	case "scrape":
+		var req scrapeRequest
+		if err := json.Unmarshal(message, &req); err != nil {
+			return fmt.Errorf("%w: %v", errMalformedMessage, err)
+		}
+		return srv.handleScrape(s, req)
+	default:
+		metrics.Add("unknown actions", 1)
+		srv.debug("ignoring unknown action", "action", action.Action)
+		return nil
+	}
+}
+
+func (srv *Server) handleAnnounce(s *socket, req request) error {
+	if req.InfoHash.IsZero() || req.PeerID.IsZero() {
+		return fmt.Errorf("%w: announce without info_hash or peer_id", errMalformedMessage)
+	}
+
+	if req.Answer != nil {
+		return srv.routeAnswer(s, req)
+	}
+	metrics.Add("announces", 1)
+
+	srv.mu.Lock()
+	if req.Event == "stopped" {
+		srv.removePeer(s, req.InfoHash, req.PeerID)
+		resp := srv.announceResponse(req.InfoHash)
+		srv.mu.Unlock()
+		return s.write(resp)
+	}
+
+	if previous, ok := s.joined[req.InfoHash]; ok && previous != req.PeerID {
+		// The client changed its peer id for this swarm on the same socket.
+		srv.removePeer(s, req.InfoHash, previous)
+	}
+	sw := srv.swarms[req.InfoHash]
+	if sw == nil {
+		sw = &swarm{peers: make(map[utils.PeerID]*peer)}
+		srv.swarms[req.InfoHash] = sw
+	}
+	p := sw.peers[req.PeerID]
+	if p == nil {
+		p = &peer{}
+		sw.peers[req.PeerID] = p
+	}
+	p.socket = s
+	p.lastSeen = time.Now()
+	complete := req.Left == 0
+	if complete && !p.complete && req.Event == "completed" {
+		sw.downloaded++
+	}
+	p.complete = complete
+	s.joined[req.InfoHash] = req.PeerID
+
+	// Hand each offer to a different random peer, or the first one to the peer it is addressed to
+	// if that peer is in the swarm.
+	offers := req.Offers
+	if len(offers) > srv.maxOffers() {
+		offers = offers[:srv.maxOffers()]
+	}
+	targets := make([]*socket, 0, len(offers))
+	if req.ToPeerID != nil && *req.ToPeerID != req.PeerID && sw.peers[*req.ToPeerID] != nil {
+		metrics.Add("directed offers", 1)
+		targets = append(targets, sw.peers[*req.ToPeerID].socket)
+	} else {
+		for id, other := range sw.peers {
+			if id != req.PeerID {
+				targets = append(targets, other.socket)
+			}
+		}
+	}
+	rand.Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+	if len(targets) > len(offers) {
+		targets = targets[:len(offers)]
+	}
+	resp := srv.announceResponse(req.InfoHash)
+	srv.mu.Unlock()
+
+	if err := s.write(resp); err != nil {
+		return err
+	}
+	for i, target := range targets {
+		offer := offers[i].Offer
+		err := target.write(webtorrent.AnnounceResponse{
+			Action:   "announce",
+			InfoHash: req.InfoHash,
+			PeerID:   &req.PeerID,
+			Offer:    &offer,
+			OfferID:  offers[i].OfferID,
+		})
+		if err != nil {
+			// The target's own read loop will notice and clean up.
+			metrics.Add("offers not delivered", 1)
+			continue
+		}
+		metrics.Add("offers relayed", 1)
+	}
+	return nil
+}
+
+func (srv *Server) routeAnswer(s *socket, req request) error {
+	if req.ToPeerID == nil {
+		return fmt.Errorf("%w: answer without to_peer_id", errMalformedMessage)
+	}
+	srv.mu.Lock()
+	var target *socket
+	if sw := srv.swarms[req.InfoHash]; sw != nil {
+		if p := sw.peers[req.PeerID]; p != nil && p.socket == s {
+			p.lastSeen = time.Now()
+		}
+		if p := sw.peers[*req.ToPeerID]; p != nil {
+			target = p.socket
+		}
+	}
+	srv.mu.Unlock()
+
+	if target == nil {
+		metrics.Add("answers for unknown peers", 1)
+		srv.debug("dropping answer for unknown peer", log.KeyPeerID, req.ToPeerID.String(), log.KeyInfoHash, req.InfoHash.Hex())
+		return nil
+	}
+	err := target.write(webtorrent.AnnounceResponse{
+		Action:   "announce",
+		InfoHash: req.InfoHash,
+		PeerID:   &req.PeerID,
+		Answer:   req.Answer,
+		OfferID:  req.OfferID,
+	})
+	if err != nil {
+		metrics.Add("answers not delivered", 1)
+		return nil
+	}
+	metrics.Add("answers relayed", 1)
+	return nil
+}
+
+func (srv *Server) handleScrape(s *socket, req scrapeRequest) error {
+	metrics.Add("scrapes", 1)
+	var infoHashes []utils.InfoHash
+	if len(req.InfoHash) > 0 && string(req.InfoHash) != "null" {
+		var single utils.InfoHash
+		if err := json.Unmarshal(req.InfoHash, &single); err == nil {
+			infoHashes = []utils.InfoHash{single}
+		} else if err := json.Unmarshal(req.InfoHash, &infoHashes); err != nil {
+			return fmt.Errorf("%w: %v", errMalformedMessage, err)
+		}
+	}
+
+	resp := ScrapeResponse{Action: "scrape", Files: make(map[string]ScrapeFile)}
+	srv.mu.Lock()
+	if infoHashes == nil {
+		for infoHash := range srv.swarms {
+			infoHashes = append(infoHashes, infoHash)
+		}
+	}
+	for _, infoHash := range infoHashes {
+		resp.Files[infoHash.JsonString()] = srv.scrapeFile(infoHash)
+	}
+	srv.mu.Unlock()
+	return s.write(resp)
+}
+
+// Must be called with srv.mu held.
+func (srv *Server) scrapeFile(infoHash utils.InfoHash) (f ScrapeFile) {
+	sw := srv.swarms[infoHash]
+	if sw == nil {
+		return
+	}
+	for _, p := range sw.peers {
+		if p.complete {
+			f.Complete++
+		} else {
+			f.Incomplete++
+		}
+	}
+	f.Downloaded = sw.downloaded
+	return
+}
+
+// Must be called with srv.mu held.
+func (srv *Server) announceResponse(infoHash utils.InfoHash) webtorrent.AnnounceResponse {
+	f := srv.scrapeFile(infoHash)
+	interval := int(srv.interval() / time.Second)
+	return webtorrent.AnnounceResponse{
+		Action:     "announce",
+		InfoHash:   infoHash,
+		Interval:   &interval,
+		Complete:   &f.Complete,
+		Incomplete: &f.Incomplete,
+	}
+}
+
+// removePeer drops peerID from the swarm if it was announced on s. Must be called with srv.mu held.
+func (srv *Server) removePeer(s *socket, infoHash utils.InfoHash, peerID utils.PeerID) {
+	if s.joined[infoHash] == peerID {
+		delete(s.joined, infoHash)
+	}
+	sw := srv.swarms[infoHash]
+	if sw == nil || sw.peers[peerID] == nil || sw.peers[peerID].socket != s {
+		return
+	}
+	delete(sw.peers, peerID)
+	if len(sw.peers) == 0 {
+		delete(srv.swarms, infoHash)
+	}
+}
+
+// reap drops peers that stopped announcing without closing their websocket.
+func (srv *Server) reap() {
+	ticker := time.NewTicker(srv.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-srv.done:
+			return
+		}
+		deadline := time.Now().Add(-srv.peerTimeout())
+		srv.mu.Lock()
+		for infoHash, sw := range srv.swarms {
+			for peerID, p := range sw.peers {
+				if p.lastSeen.Before(deadline) {
+					metrics.Add("peers expired", 1)
+					srv.removePeer(p.socket, infoHash, peerID)
+				}
+			}
+		}
+		srv.mu.Unlock()
+	}
+}
+
+// Close disconnects every client. Later requests are refused.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.closed {
+		return ErrServerClosed
+	}
+	srv.closed = true
+	if srv.done != nil {
+		close(srv.done)
+	}
+	for s := range srv.sockets {
+		s.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+	"github.com/DaniilSokolyuk/gop2pt/webtorrent"
+)
+
+func dial(t *testing.T, srv *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestMalformedMessagesKeepSocketOpen(t *testing.T) {
+	srv := httptest.NewServer(&Server{})
+	defer srv.Close()
+	conn := dial(t, srv)
+
+	for _, msg := range []string{
+		"not json",
+		`{"action":"announce","info_hash":5}`,
+		`{"action":"announce"}`,
+		`{"action":"scrape","info_hash":{}}`,
+		`{"action":"unknown"}`,
+	} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infoHash := utils.MakeInfoHash("malformed")
+	if err := conn.WriteJSON(webtorrent.AnnounceRequest{
+		Action:   "announce",
+		InfoHash: infoHash,
+		PeerID:   utils.PeerID{1},
+		Left:     1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var resp webtorrent.AnnounceResponse
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("socket closed after malformed messages: %v", err)
+	}
+	if resp.Action != "announce" || resp.InfoHash != infoHash || resp.Interval == nil {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if resp.Incomplete == nil || *resp.Incomplete != 1 {
+		t.Fatalf("announce after malformed messages not counted: %+v", resp)
+	}
+}
+
+// announce joins conn to infoHash with the given offers and reads the announce response.
+func announce(t *testing.T, conn *websocket.Conn, infoHash utils.InfoHash, req webtorrent.AnnounceRequest) {
+	t.Helper()
+	req.Action = "announce"
+	req.InfoHash = infoHash
+	if err := conn.WriteJSON(req); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var resp webtorrent.AnnounceResponse
+	if err := conn.ReadJSON(&resp); err != nil || resp.Offer != nil {
+		t.Fatalf("reading announce response: %+v, %v", resp, err)
+	}
+}
+
+func TestDirectedOffer(t *testing.T) {
+	srv := httptest.NewServer(&Server{})
+	defer srv.Close()
+	infoHash := utils.MakeInfoHash("directed")
+	from, other, to := dial(t, srv), dial(t, srv), dial(t, srv)
+	announce(t, other, infoHash, webtorrent.AnnounceRequest{PeerID: utils.PeerID{2}})
+	announce(t, to, infoHash, webtorrent.AnnounceRequest{PeerID: utils.PeerID{3}})
+
+	var offers []webtorrent.Offer
+	for i := 0; i < 3; i++ {
+		offers = append(offers, webtorrent.Offer{
+			OfferID: strings.Repeat(string(rune('a'+i)), 20),
+			Offer:   webtorrent.SessionDescription{SessionDescription: webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "v=0"}},
+		})
+	}
+	announce(t, from, infoHash, webtorrent.AnnounceRequest{PeerID: utils.PeerID{1}, Offers: offers, ToPeerID: &utils.PeerID{3}})
+
+	to.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var resp webtorrent.AnnounceResponse
+	if err := to.ReadJSON(&resp); err != nil {
+		t.Fatalf("addressed peer got no offer: %v", err)
+	}
+	if resp.Offer == nil || resp.OfferID != offers[0].OfferID || resp.PeerID == nil || *resp.PeerID != (utils.PeerID{1}) {
+		t.Fatalf("addressed peer got %+v, want the first offer from peer 1", resp)
+	}
+
+	other.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if err := other.ReadJSON(&resp); err == nil {
+		t.Fatalf("offer addressed to another peer delivered: %+v", resp)
+	}
+}
@@ -7,14 +7,36 @@ package webtorrent
 import (
 	"io"
 
+	"github.com/pion/ice/v2"
 	"github.com/pion/logging"
+	"github.com/pion/transport/vnet"
 	"github.com/pion/webrtc/v3"
 )
 
-var s = webrtc.SettingEngine{
-	// This could probably be done with better integration into anacrolix/log, but I'm not sure if
-	// it's worth the effort.
-	LoggerFactory: discardLoggerFactory{},
+// NewSettingEngine returns the pion settings TrackerClients use by default, to be customized and
+// passed to NewTransport.
+func NewSettingEngine() webrtc.SettingEngine {
+	return webrtc.SettingEngine{
+		// This could probably be done with better integration into anacrolix/log, but I'm not sure if
+		// it's worth the effort.
+		LoggerFactory: discardLoggerFactory{},
+	}
+}
+
+// enableMDNS hides host candidate addresses behind mDNS names, as browsers do.
+func enableMDNS(s *webrtc.SettingEngine) {
+	s.SetICEMulticastDNSMode(ice.MulticastDNSModeQueryAndGather)
+}
+
+// SetVNet routes all peer connection traffic through n, a simulated network, instead of the real
+// interfaces.
+func SetVNet(s *webrtc.SettingEngine, n *vnet.Net) {
+	s.SetVNet(n)
+}
+
+// SetLoggerFactory routes pion's logs to f, instead of discarding them.
+func SetLoggerFactory(s *webrtc.SettingEngine, f logging.LoggerFactory) {
+	s.LoggerFactory = f
 }
 
 type discardLoggerFactory struct{}
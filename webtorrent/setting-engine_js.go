@@ -5,9 +5,24 @@
 package webtorrent
 
 import (
+	"github.com/pion/logging"
+	"github.com/pion/transport/vnet"
 	"github.com/pion/webrtc/v3"
 )
 
-// I'm not sure what to do for logging for JS. See
-// https://gophers.slack.com/archives/CAK2124AG/p1649651943947579.
-var s = webrtc.SettingEngine{}
+// NewSettingEngine returns the pion settings TrackerClients use by default, to be customized and
+// passed to NewTransport.
+func NewSettingEngine() webrtc.SettingEngine {
+	// I'm not sure what to do for logging for JS. See
+	// https://gophers.slack.com/archives/CAK2124AG/p1649651943947579.
+	return webrtc.SettingEngine{}
+}
+
+// Browsers obfuscate host candidates with mDNS on their own.
+func enableMDNS(*webrtc.SettingEngine) {}
+
+// The browser owns the network stack, so it can't be simulated.
+func SetVNet(*webrtc.SettingEngine, *vnet.Net) {}
+
+// The browser's WebRTC stack doesn't log through pion.
+func SetLoggerFactory(*webrtc.SettingEngine, logging.LoggerFactory) {}
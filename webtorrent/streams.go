@@ -0,0 +1,85 @@
+package webtorrent
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pion/datachannel"
+	"github.com/pion/webrtc/v3"
+)
+
+// Data channels the peer opens before anyone handles them are queued up to this many, the rest
+// are closed.
+const maxQueuedDataChannels = 16
+
+var ErrDataChannelClosed = errors.New("data channel closed before it opened")
+
+// OpenDataChannel opens another data channel to the peer, next to the one the conn was delivered
+// with. The peer receives it through OnDataChannel. The channel is closed on its own, without
+// taking the peer connection down, but goes away with it.
+func (me *DataChannelContext) OpenDataChannel(ctx context.Context, label string) (datachannel.ReadWriteCloser, error) {
+	dc, err := me.peerConnection.CreateDataChannel(label, nil)
+	if err != nil {
+		return nil, err
+	}
+	opened := make(chan datachannel.ReadWriteCloser, 1)
+	closed := make(chan struct{})
+	dc.OnOpen(func() {
+		raw, err := dc.Detach()
+		if err != nil {
+			panic(err)
+		}
+		opened <- raw
+	})
+	dc.OnClose(func() { close(closed) })
+	select {
+	case raw := <-opened:
+		return raw, nil
+	case <-closed:
+		return nil, ErrDataChannelClosed
+	case <-ctx.Done():
+		dc.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// OnDataChannel calls f with every data channel the peer opens after the one the conn was
+// delivered with. Channels that opened before f was set are passed to it right away.
+func (me *DataChannelContext) OnDataChannel(f func(datachannel.ReadWriteCloser)) {
+	pc := me.peerConnection
+	pc.streamsMu.Lock()
+	queued := pc.queuedStreams
+	pc.queuedStreams = nil
+	pc.onStream = f
+	pc.streamsMu.Unlock()
+	for _, raw := range queued {
+		f(raw)
+	}
+}
+
+// handleStream detaches a data channel opened by the peer after the first one and hands it to the
+// OnDataChannel handler.
+func (me *wrappedPeerConnection) handleStream(dc *webrtc.DataChannel) {
+	dc.OnOpen(func() {
+		raw, err := dc.Detach()
+		if err != nil {
+			panic(err)
+		}
+		me.streamsMu.Lock()
+		f := me.onStream
+		if f == nil {
+			if len(me.queuedStreams) < maxQueuedDataChannels {
+				me.queuedStreams = append(me.queuedStreams, raw)
+				raw = nil
+			}
+		}
+		me.streamsMu.Unlock()
+		switch {
+		case f != nil:
+			f(raw)
+		case raw != nil:
+			metrics.Add("dropped data channels", 1)
+			raw.Close()
+		}
+	})
+}
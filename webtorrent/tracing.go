@@ -0,0 +1,127 @@
+package webtorrent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+// TracerName is the instrumentation name to get TrackerClient.Tracer by.
+const TracerName = "github.com/DaniilSokolyuk/gop2pt/webtorrent"
+
+var (
+	errOfferTimedOut  = errors.New("offer timed out")
+	errAnswerTimedOut = errors.New("data channel not opened in time")
+	errOfferWithdrawn = errors.New("offer withdrawn")
+)
+
+// Both peers see the same offer ID, so searching for it finds the spans of either side.
+func offerIDAttr(offerId string) attribute.KeyValue {
+	return attribute.String("webtorrent.offer_id", hex.EncodeToString(utils.JsonStringToBinary(offerId)))
+}
+
+// offerLink links to the offer with offerId. The span context linked to is derived from the offer
+// ID, so the offer span of the peer that sent it and the answer span of the peer that answered it
+// link to the same one, and tracing backends can join them across both traces.
+func offerLink(offerId string) trace.Link {
+	sum := sha256.Sum256(utils.JsonStringToBinary(offerId))
+	var sc trace.SpanContextConfig
+	copy(sc.TraceID[:], sum[:])
+	copy(sc.SpanID[:], sum[len(sc.TraceID):])
+	sc.Remote = true
+	return trace.Link{
+		SpanContext: trace.NewSpanContext(sc),
+		Attributes:  []attribute.KeyValue{offerIDAttr(offerId)},
+	}
+}
+
+func peerIDAttr(peerId utils.PeerID) attribute.KeyValue {
+	return attribute.String("webtorrent.peer_id", peerId.String())
+}
+
+func (tc *TrackerClient) tracer() trace.Tracer {
+	if tc.Tracer == nil {
+		return trace.NewNoopTracerProvider().Tracer(TracerName)
+	}
+	return tc.Tracer
+}
+
+// startSignalingSpan starts the root span of one offer of ours, or of answering one from a peer,
+// linked to the offer, see offerLink.
+func (tc *TrackerClient) startSignalingSpan(name string, infoHash utils.InfoHash, offerId string) (context.Context, trace.Span) {
+	return tc.tracer().Start(context.Background(), name, trace.WithAttributes(
+		offerIDAttr(offerId),
+		attribute.String("webtorrent.info_hash", infoHash.Hex()),
+		attribute.String("webtorrent.tracker", tc.Url),
+	), trace.WithLinks(offerLink(offerId)))
+}
+
+// startAnnounceSpan starts the root span of sending offers to the tracker, linked to the span of
+// each offer.
+func (tc *TrackerClient) startAnnounceSpan(infoHash utils.InfoHash, offers []trace.Link) trace.Span {
+	_, span := tc.tracer().Start(context.Background(), "webtorrent.announce", trace.WithAttributes(
+		attribute.String("webtorrent.info_hash", infoHash.Hex()),
+		attribute.String("webtorrent.tracker", tc.Url),
+		attribute.Int("webtorrent.offers", len(offers)),
+	), trace.WithLinks(offers...))
+	return span
+}
+
+// startSpan starts a step of the signaling span in ctx.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(TracerName).Start(ctx, name)
+}
+
+// endSpan ends span, recording err as its failure unless nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// offerTrace follows one of our offers from creation until its data channel opens.
+type offerTrace struct {
+	ctx  context.Context
+	span trace.Span
+
+	mu sync.Mutex
+	// Waiting for the data channel, once the answer is set.
+	open  trace.Span
+	ended bool
+}
+
+// startOpen starts waiting for the data channel, unless the offer already ended.
+func (t *offerTrace) startOpen() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.ended {
+		_, t.open = startSpan(t.ctx, "data channel open")
+	}
+}
+
+// end ends the offer's spans, recording err as the failure unless nil. Only the first call has an
+// effect, as the offer timing out can race with its data channel opening.
+func (t *offerTrace) end(err error) {
+	t.mu.Lock()
+	if t.ended {
+		t.mu.Unlock()
+		return
+	}
+	t.ended = true
+	open := t.open
+	t.mu.Unlock()
+	if open != nil {
+		endSpan(open, err)
+	}
+	endSpan(t.span, err)
+}
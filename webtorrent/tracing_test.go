@@ -0,0 +1,149 @@
+package webtorrent
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/datachannel"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+// countingSpan counts how often it is ended.
+type countingSpan struct {
+	trace.Span
+	ends int32
+}
+
+func (s *countingSpan) End(...trace.SpanEndOption) { atomic.AddInt32(&s.ends, 1) }
+
+func TestOfferTraceEndsOnce(t *testing.T) {
+	span := &countingSpan{Span: trace.SpanFromContext(context.Background())}
+	tr := &offerTrace{ctx: context.Background(), span: span}
+	tr.startOpen()
+	open := &countingSpan{Span: tr.open}
+	tr.open = open
+
+	var wg sync.WaitGroup
+	for _, err := range []error{nil, errOfferTimedOut, errOfferWithdrawn} {
+		wg.Add(1)
+		go func(err error) {
+			defer wg.Done()
+			tr.end(err)
+		}(err)
+	}
+	wg.Wait()
+	if span.ends != 1 || open.ends != 1 {
+		t.Fatalf("offer span ended %d times and open span %d times, want once each", span.ends, open.ends)
+	}
+}
+
+func TestOfferTraceOpenAfterEnd(t *testing.T) {
+	tr := &offerTrace{ctx: context.Background(), span: trace.SpanFromContext(context.Background())}
+	tr.end(errOfferTimedOut)
+	tr.startOpen()
+	if tr.open != nil {
+		t.Fatal("data channel open span started after the offer ended")
+	}
+}
+
+// recordingTracer records the options spans are started with, and gives each span its own
+// span context.
+type recordingTracer struct {
+	mu    sync.Mutex
+	next  byte
+	spans map[string]*trace.SpanConfig
+}
+
+func (rt *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.spans == nil {
+		rt.spans = make(map[string]*trace.SpanConfig)
+	}
+	cfg := trace.NewSpanStartConfig(opts...)
+	rt.spans[name] = &cfg
+	rt.next++
+	ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{rt.next},
+		SpanID:  trace.SpanID{rt.next},
+	}))
+	return ctx, trace.SpanFromContext(ctx)
+}
+
+func TestSpansLinkedByOfferID(t *testing.T) {
+	offerId := utils.MakePeerID().JsonString()
+	link := offerLink(offerId)
+	if !link.SpanContext.IsValid() || !link.SpanContext.Equal(offerLink(offerId).SpanContext) {
+		t.Fatalf("offer link %v is not valid and stable", link.SpanContext)
+	}
+	if other := offerLink(utils.MakePeerID().JsonString()); other.SpanContext.Equal(link.SpanContext) {
+		t.Fatal("offers share their link")
+	}
+
+	// Each peer links to the offer from its own trace.
+	infoHash := utils.MakeInfoHash("spans")
+	offerer, answerer := &recordingTracer{}, &recordingTracer{}
+	ctx, _ := (&TrackerClient{Tracer: offerer}).startSignalingSpan("webtorrent.offer", infoHash, offerId)
+	(&TrackerClient{Tracer: answerer}).startSignalingSpan("webtorrent.answer", infoHash, offerId)
+	for _, links := range [][]trace.Link{offerer.spans["webtorrent.offer"].Links(), answerer.spans["webtorrent.answer"].Links()} {
+		if len(links) != 1 || !links[0].SpanContext.Equal(link.SpanContext) {
+			t.Errorf("signaling span links %v, want the offer link", links)
+		}
+	}
+
+	(&TrackerClient{Tracer: offerer}).startAnnounceSpan(infoHash, []trace.Link{trace.LinkFromContext(ctx)})
+	links := offerer.spans["webtorrent.announce"].Links()
+	if len(links) != 1 || !links[0].SpanContext.Equal(trace.SpanContextFromContext(ctx)) {
+		t.Errorf("announce span links %v, want the offer span", links)
+	}
+}
+
+// closeRecorder is a data channel that only records being closed.
+type closeRecorder struct {
+	datachannel.ReadWriteCloser
+	closed int32
+}
+
+func (cr *closeRecorder) Close() error {
+	atomic.AddInt32(&cr.closed, 1)
+	return nil
+}
+
+// The data channel opening just after the answer timed out must not be handed out.
+func TestAnswerOpenedAfterTimeout(t *testing.T) {
+	infoHash := utils.MakeInfoHash("answer timeout")
+	for _, timedOut := range []bool{false, true} {
+		var delivered int
+		tc := &TrackerClient{
+			pending: make(map[*wrappedPeerConnection]struct{}),
+			swarms: map[utils.InfoHash]onDataChannelOpen{
+				infoHash: func(datachannel.ReadWriteCloser, DataChannelContext) { delivered++ },
+			},
+		}
+		in := &inboundOffer{
+			infoHash: infoHash,
+			trace:    &offerTrace{ctx: context.Background(), span: trace.SpanFromContext(context.Background())},
+		}
+		if timedOut {
+			fired := make(chan struct{})
+			in.timeout = time.AfterFunc(0, func() { close(fired) })
+			<-fired
+		} else {
+			in.timeout = time.AfterFunc(time.Hour, func() {})
+		}
+		rec := &closeRecorder{}
+		tc.answerOpened(in, &monitoredDataChannel{ReadWriteCloser: rec, done: make(chan struct{})})
+
+		if timedOut && (delivered != 0 || rec.closed != 1) {
+			t.Errorf("after the timeout, delivered %d conns and closed the channel %d times, want none and once", delivered, rec.closed)
+		}
+		if !timedOut && (delivered != 1 || rec.closed != 0) {
+			t.Errorf("delivered %d conns and closed the channel %d times, want one and none", delivered, rec.closed)
+		}
+	}
+}
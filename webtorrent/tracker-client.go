@@ -2,35 +2,80 @@ package webtorrent
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/DaniilSokolyuk/gop2pt/event"
 	"github.com/DaniilSokolyuk/gop2pt/log"
 	"github.com/DaniilSokolyuk/gop2pt/utils"
 
 	"github.com/gorilla/websocket"
 	"github.com/pion/datachannel"
 	"github.com/pion/webrtc/v3"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const offerTimeOut = time.Second * 30
 
+// ErrNotConnected is returned from announces while the websocket to the tracker is down. Every
+// swarm is announced again once it reconnects.
+var ErrNotConnected = errors.New("not connected to tracker")
+
 type TrackerClientStats struct {
 	Dials                  int64
 	ConvertedInboundConns  int64
 	ConvertedOutboundConns int64
+	// Offers and answers from peers rejected by the SDPPolicy.
+	RejectedOffers  int64
+	RejectedAnswers int64
+	// Candidates removed from offers and answers by the SDPPolicy.
+	DroppedCandidates int64
+	// Offers we announced, and how many of them a peer answered.
+	OffersSent     int64
+	OffersAnswered int64
+	// Median time from announcing an offer to receiving its answer, over recent answers.
+	MedianTimeToAnswer time.Duration
+	// Counts of the failure events emitted, by type.
+	Failures map[event.Type]int64
+	// Counts of the same failures by what caused them, keyed by the Reason constants.
+	FailureReasons map[string]int64
+	// The error of the latest failure event, and when it was emitted.
+	LastError     error
+	LastErrorTime time.Time
+	// How well the tracker yields peers, from 0 to 1. See score.
+	Score float64
 }
 
 // Client represents the webtorrent client
 type TrackerClient struct {
-	NumWant  int
-	Url      string
-	PeerId   string
-	InfoHash string
+	NumWant int
+	Url     string
+	PeerId  utils.PeerID
+	// Joined on Start with OnConn, unless zero. More swarms can be joined with Join.
+	InfoHash utils.InfoHash
 	OnConn   onDataChannelOpen
 	Logger   log.Logger
 	Dialer   *websocket.Dialer
+	// Builds the websocket handshake headers before every connection attempt. Optional.
+	DialHeader func() (http.Header, error)
+	// Controls detection of dead peers on conns handed to OnConn.
+	Health HealthConfig
+	// Receives tracker, signaling and peer lifecycle events. Optional.
+	OnEvent event.Handler
+	// Signs our offers and answers so peers can detect tampering by the tracker. Optional.
+	Signer SDPSigner
+	// Rejects offers and answers from peers that aren't signed.
+	RequireSignedSDP bool
+	// Validates and filters offers and answers from peers. Nil applies the zero SDPPolicy.
+	SDPPolicy *SDPPolicy
+	// Creates peer connections. Defaults to a Transport using NewSettingEngine.
+	Transport *Transport
+	// Traces the signaling of every offer we send or answer, see TracerName. Optional.
+	Tracer trace.Tracer
 
 	mu             sync.Mutex
 	cond           sync.Cond
@@ -39,26 +84,65 @@ type TrackerClient struct {
 	closed         bool
 	stats          TrackerClientStats
 	pingTicker     *time.Ticker
+	// Peer connections with an answer that haven't opened their data channel yet.
+	pending map[*wrappedPeerConnection]struct{}
+	// The swarms we announce to, and where their conns go.
+	swarms map[utils.InfoHash]onDataChannelOpen
+	// Recent times to answer, oldest first.
+	answerTimes []time.Duration
 }
 
 func (tc *TrackerClient) Stats() TrackerClientStats {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
-	return tc.stats
+	stats := tc.stats
+	stats.Failures = make(map[event.Type]int64, len(tc.stats.Failures))
+	for t, n := range tc.stats.Failures {
+		stats.Failures[t] = n
+	}
+	stats.FailureReasons = make(map[string]int64, len(tc.stats.FailureReasons))
+	for reason, n := range tc.stats.FailureReasons {
+		stats.FailureReasons[reason] = n
+	}
+	stats.MedianTimeToAnswer = median(tc.answerTimes)
+	stats.Score = stats.score()
+	return stats
+}
+
+// SetNumWant changes how many offers each announce sends from now on.
+func (tc *TrackerClient) SetNumWant(numWant int) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.NumWant = numWant
 }
 
 // outboundOffer represents an outstanding offer.
 type outboundOffer struct {
+	infoHash       utils.InfoHash
+	sent           time.Time
 	originalOffer  webrtc.SessionDescription
 	peerConnection *wrappedPeerConnection
 	dataChannel    *webrtc.DataChannel
 	timeout        *time.Timer
+	trace          *offerTrace
+}
+
+// inboundOffer is an offer from a peer that we answered, until its data channel opens.
+type inboundOffer struct {
+	infoHash       utils.InfoHash
+	offerId        string
+	peerId         utils.PeerID
+	offer, answer  webrtc.SessionDescription
+	peerConnection *wrappedPeerConnection
+	timeout        *time.Timer
+	trace          *offerTrace
 }
 
 type DataChannelContext struct {
 	// Can these be obtained by just calling the relevant methods on peerConnection?
 	Local, Remote webrtc.SessionDescription
-	PeerID        string
+	InfoHash      utils.InfoHash
+	PeerID        utils.PeerID
 	OfferId       string
 	LocalOffered  bool
 	// This is private as some methods might not be appropriate with data channel context.
@@ -76,16 +160,28 @@ func (tc *TrackerClient) doWebsocket() error {
 	tc.mu.Lock()
 	tc.stats.Dials++
 	tc.mu.Unlock()
-	c, _, err := tc.Dialer.Dial(tc.Url, nil)
+	var header http.Header
+	if tc.DialHeader != nil {
+		var err error
+		header, err = tc.DialHeader()
+		if err != nil {
+			tc.emit(event.Event{Type: event.TrackerConnectFailed, Err: err})
+			return err
+		}
+	}
+	c, _, err := tc.Dialer.Dial(tc.Url, header)
 	if err != nil {
+		tc.emit(event.Event{Type: event.TrackerConnectFailed, Err: err})
 		return fmt.Errorf("dialing tracker: %w", err)
 	}
 	defer c.Close()
-	tc.Logger.Debug("connected to tracker: %s", tc.Url)
+	tc.Logger.Debug("connected to tracker", log.KeyTracker, tc.Url)
+	tc.emit(event.Event{Type: event.TrackerConnected})
 	tc.mu.Lock()
 	tc.wsConn = c
 	tc.cond.Broadcast()
 	tc.mu.Unlock()
+	go tc.Announce()
 	closeChan := make(chan struct{})
 	go func() {
 		for {
@@ -107,7 +203,9 @@ func (tc *TrackerClient) doWebsocket() error {
 	close(closeChan)
 	tc.mu.Lock()
 	c.Close()
+	tc.wsConn = nil
 	tc.mu.Unlock()
+	tc.emit(event.Event{Type: event.TrackerDisconnected, Err: err})
 	return err
 }
 
@@ -118,6 +216,11 @@ func (tc *TrackerClient) Start(onStop func(error)) {
 	tc.pingTicker = time.NewTicker(60 * time.Second)
 	tc.cond.L = &tc.mu
 	tc.outboundOffers = make(map[string]outboundOffer, 0)
+	tc.pending = make(map[*wrappedPeerConnection]struct{})
+	tc.swarms = make(map[utils.InfoHash]onDataChannelOpen)
+	if !tc.InfoHash.IsZero() {
+		tc.swarms[tc.InfoHash] = tc.OnConn
+	}
 	go func() {
 		onStop(tc.run())
 	}()
@@ -130,7 +233,7 @@ func (tc *TrackerClient) run() error {
 		err := tc.doWebsocket()
 		tc.mu.Lock()
 		tc.mu.Unlock()
-		tc.Logger.Debug("websocket instance ended: %v", err)
+		tc.Logger.Debug("websocket instance ended", log.KeyTracker, tc.Url, log.KeyError, err)
 		time.Sleep(time.Minute)
 		tc.mu.Lock()
 	}
@@ -151,68 +254,271 @@ func (tc *TrackerClient) Close() error {
 	return nil
 }
 
+// Stop leaves every swarm, telling the tracker so, and closes the client. Conns already handed
+// out are left alone.
+func (tc *TrackerClient) Stop() error {
+	tc.mu.Lock()
+	swarms := make([]utils.InfoHash, 0, len(tc.swarms))
+	for infoHash := range tc.swarms {
+		swarms = append(swarms, infoHash)
+	}
+	tc.mu.Unlock()
+	var err error
+	for _, infoHash := range swarms {
+		if leaveErr := tc.Leave(infoHash); leaveErr != nil && err == nil {
+			err = leaveErr
+		}
+	}
+	tc.Close()
+	return err
+}
+
 func (tc *TrackerClient) closeUnusedOffers() {
 	for _, offer := range tc.outboundOffers {
 		offer.peerConnection.Close()
+		offer.trace.end(errOfferWithdrawn)
 	}
 	tc.outboundOffers = nil
+	for pc := range tc.pending {
+		pc.Close()
+	}
+	tc.pending = nil
 }
 
 func (tc *TrackerClient) Announce() error {
+	announces, err := tc.announce()
+	if err != nil {
+		tc.emit(event.Event{Type: event.AnnounceFailed, Err: err})
+		return err
+	}
+	for _, a := range announces {
+		tc.emitAnnounce(a)
+		if a.err != nil && err == nil {
+			err = a.err
+		}
+	}
+	return err
+}
+
+// swarmAnnounce is the outcome of announcing to one swarm.
+type swarmAnnounce struct {
+	infoHash utils.InfoHash
+	offerIDs []string
+	err      error
+}
+
+func (tc *TrackerClient) emitAnnounce(a swarmAnnounce) {
+	if a.err != nil {
+		tc.emit(event.Event{Type: event.AnnounceFailed, InfoHash: a.infoHash, Err: a.err})
+		return
+	}
+	for _, offerID := range a.offerIDs {
+		tc.emit(event.Event{Type: event.OfferSent, InfoHash: a.infoHash, OfferID: offerID, LocalOffered: true})
+	}
+	tc.emit(event.Event{Type: event.AnnounceSucceeded, InfoHash: a.infoHash})
+}
+
+// Join starts announcing to the swarm of infoHash too, handing its conns to onConn. It announces
+// right away if connected, and otherwise once the websocket is up.
+func (tc *TrackerClient) Join(infoHash utils.InfoHash, onConn onDataChannelOpen) error {
+	a, announced := tc.join(infoHash, onConn)
+	if announced {
+		tc.emitAnnounce(a)
+	}
+	return a.err
+}
+
+func (tc *TrackerClient) join(infoHash utils.InfoHash, onConn onDataChannelOpen) (a swarmAnnounce, announced bool) {
+	a.infoHash = infoHash
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.closed {
+		a.err = fmt.Errorf("%T closed", tc)
+		return a, true
+	}
+	tc.swarms[infoHash] = onConn
+	if tc.wsConn == nil {
+		return a, false
+	}
+	a.offerIDs, a.err = tc.announceSwarm(infoHash)
+	return a, true
+}
+
+// Connected reports whether the websocket to the tracker is up.
+func (tc *TrackerClient) Connected() bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.wsConn != nil
+}
+
+// Leave stops announcing to the swarm of infoHash, and tells the tracker so if connected. Conns
+// already handed out are left alone.
+func (tc *TrackerClient) Leave(infoHash utils.InfoHash) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if _, ok := tc.swarms[infoHash]; !ok {
+		return nil
+	}
+	delete(tc.swarms, infoHash)
+	for offerId, offer := range tc.outboundOffers {
+		if offer.infoHash == infoHash {
+			offer.timeout.Stop()
+			offer.peerConnection.Close()
+			offer.trace.end(errOfferWithdrawn)
+			delete(tc.outboundOffers, offerId)
+		}
+	}
+	if tc.closed || tc.wsConn == nil {
+		return nil
+	}
+	data, err := json.Marshal(AnnounceRequest{
+		Left:     -1,
+		Action:   "announce",
+		Event:    "stopped",
+		InfoHash: infoHash,
+		PeerID:   tc.PeerId,
+	})
+	if err != nil {
+		return fmt.Errorf("marshalling request: %w", err)
+	}
+	return tc.writeMessage(data)
+}
+
+func (tc *TrackerClient) announce() ([]swarmAnnounce, error) {
 	metrics.Add("outbound announces", 1)
 
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
+	if tc.closed {
+		return nil, fmt.Errorf("%T closed", tc)
+	}
+	if tc.wsConn == nil {
+		return nil, ErrNotConnected
+	}
 
-	offers := make([]Offer, tc.NumWant)
-	for i := 0; i < tc.NumWant; i++ {
-		offerIDBinary := utils.MakePeerID()
+	announces := make([]swarmAnnounce, 0, len(tc.swarms))
+	for infoHash := range tc.swarms {
+		offerIDs, err := tc.announceSwarm(infoHash)
+		announces = append(announces, swarmAnnounce{infoHash: infoHash, offerIDs: offerIDs, err: err})
+	}
+	return announces, nil
+}
 
-		pc, dc, offer, err := newOffer()
+// OfferTo sends a single offer to the swarm of infoHash, addressed to peerID. webtorrent/server
+// relays it to that peer only. Other trackers hand it to a random peer like any other offer.
+func (tc *TrackerClient) OfferTo(infoHash utils.InfoHash, peerID utils.PeerID) error {
+	a := swarmAnnounce{infoHash: infoHash}
+	tc.mu.Lock()
+	if _, ok := tc.swarms[infoHash]; !ok {
+		tc.mu.Unlock()
+		return fmt.Errorf("not announcing to %s", infoHash.Hex())
+	}
+	switch {
+	case tc.closed:
+		a.err = fmt.Errorf("%T closed", tc)
+	case tc.wsConn == nil:
+		a.err = ErrNotConnected
+	default:
+		a.offerIDs, a.err = tc.sendOffers(infoHash, 1, &peerID)
+	}
+	tc.mu.Unlock()
+	tc.emitAnnounce(a)
+	return a.err
+}
+
+// announceSwarm sends fresh offers to the swarm of infoHash, returning their IDs. Must be called
+// with tc.mu held.
+func (tc *TrackerClient) announceSwarm(infoHash utils.InfoHash) ([]string, error) {
+	return tc.sendOffers(infoHash, tc.NumWant, nil)
+}
+
+// sendOffers announces numWant fresh offers to the swarm of infoHash, addressed to a single peer
+// unless to is nil, returning their IDs. Must be called with tc.mu held.
+func (tc *TrackerClient) sendOffers(infoHash utils.InfoHash, numWant int, to *utils.PeerID) ([]string, error) {
+	offers := make([]Offer, numWant)
+	for i := 0; i < numWant; i++ {
+		offerIDBinary := utils.MakePeerID().JsonString()
+		ctx, span := tc.startSignalingSpan("webtorrent.offer", infoHash, offerIDBinary)
+		tr := &offerTrace{ctx: ctx, span: span}
+
+		pc, dc, offer, err := tc.transport().newOffer(ctx)
 		if err != nil {
-			return fmt.Errorf("creating offer: %w", err)
+			tr.end(err)
+			return nil, fmt.Errorf("creating offer: %w", err)
 		}
 
 		tc.outboundOffers[offerIDBinary] = outboundOffer{
+			infoHash:       infoHash,
+			sent:           time.Now(),
 			peerConnection: pc,
 			dataChannel:    dc,
 			originalOffer:  offer,
+			trace:          tr,
+			// Also bounds the time from the answer to the data channel opening.
 			timeout: time.AfterFunc(offerTimeOut, func() {
 				tc.mu.Lock()
-				defer tc.mu.Unlock()
+				_, outstanding := tc.outboundOffers[offerIDBinary]
+				_, pending := tc.pending[pc]
+				if !outstanding && !pending {
+					// Opened, withdrawn or closed meanwhile.
+					tc.mu.Unlock()
+					return
+				}
 				pc.Close()
 				delete(tc.outboundOffers, offerIDBinary)
+				delete(tc.pending, pc)
+				tc.mu.Unlock()
+				tr.end(errOfferTimedOut)
+				tc.emit(event.Event{Type: event.OfferTimedOut, InfoHash: infoHash, OfferID: offerIDBinary, LocalOffered: true})
 			}),
 		}
 
 		offers[i] = Offer{
 			OfferID: offerIDBinary,
-			Offer:   offer,
+			Offer:   tc.signSDP(offer, infoHash, offerIDBinary),
 		}
 	}
 
 	req := AnnounceRequest{
-		Numwant:    tc.NumWant,
+		Numwant:    numWant,
 		Uploaded:   0,
 		Downloaded: 0,
 		Left:       -1,
 		Action:     "announce",
-		InfoHash:   tc.InfoHash,
+		InfoHash:   infoHash,
 		PeerID:     tc.PeerId,
 		Offers:     offers,
+		ToPeerID:   to,
 	}
 
 	data, err := json.Marshal(req)
 	if err != nil {
-		return fmt.Errorf("marshalling request: %w", err)
+		return nil, fmt.Errorf("marshalling request: %w", err)
 	}
 
+	links := make([]trace.Link, len(offers))
+	sendSpans := make([]trace.Span, len(offers))
+	for i := range offers {
+		ctx := tc.outboundOffers[offers[i].OfferID].trace.ctx
+		links[i] = trace.LinkFromContext(ctx)
+		_, sendSpans[i] = startSpan(ctx, "tracker send")
+	}
+	announceSpan := tc.startAnnounceSpan(infoHash, links)
 	err = tc.writeMessage(data)
+	for _, span := range sendSpans {
+		endSpan(span, err)
+	}
+	endSpan(announceSpan, err)
 	if err != nil {
-		return fmt.Errorf("write AnnounceRequest: %w", err)
+		return nil, fmt.Errorf("write AnnounceRequest: %w", err)
 	}
+	tc.stats.OffersSent += int64(len(offers))
 
-	return nil
+	offerIDs := make([]string, len(offers))
+	for i := range offers {
+		offerIDs[i] = offers[i].OfferID
+	}
+	return offerIDs, nil
 }
 
 func (tc *TrackerClient) writeMessage(data []byte) error {
@@ -234,43 +540,80 @@ func (tc *TrackerClient) trackerReadLoop(tracker *websocket.Conn) error {
 
 		var ar AnnounceResponse
 		if err := json.Unmarshal(message, &ar); err != nil {
-			tc.Logger.Error("error unmarshalling announce response: %v", err)
+			tc.Logger.Error("error unmarshalling announce response", log.KeyTracker, tc.Url, log.KeyError, err)
 			continue
 		}
 
-		if ar.InfoHash != "" && ar.InfoHash != tc.InfoHash {
-			tc.Logger.Debug("ignoring websocket data from %s for %s (looking for %s: reused socket)",
-				tc.Url, ar.InfoHash, tc.InfoHash)
+		tc.mu.Lock()
+		_, joined := tc.swarms[ar.InfoHash]
+		tc.mu.Unlock()
+		if !joined {
+			tc.Logger.Debug("ignoring websocket data for swarm not joined (reused socket)",
+				log.KeyTracker, tc.Url, log.KeyInfoHash, ar.InfoHash.Hex())
 			continue
 		}
 
-		if ar.PeerID != "" && ar.PeerID == tc.PeerId {
+		if ar.peerIDErr != nil {
+			metrics.Add("malformed peer ids", 1)
+			tc.Logger.Debug("ignoring message with malformed peer id", log.KeyTracker, tc.Url, log.KeyOfferID, log.OfferID(ar.OfferID), log.KeyError, ar.peerIDErr)
+			continue
+		}
+		if ar.PeerID == nil {
+			// an announce response, or something we can't answer
+			continue
+		}
+		if *ar.PeerID == tc.PeerId {
 			// ignore offers/answers from this client
 			continue
 		}
 
 		switch {
 		case ar.Offer != nil:
-			tc.handleOffer(*ar.Offer, ar.OfferID, ar.PeerID)
+			tc.handleOffer(ar.InfoHash, *ar.Offer, ar.OfferID, *ar.PeerID)
 		case ar.Answer != nil:
-			tc.handleAnswer(ar.OfferID, *ar.Answer, ar.PeerID)
+			tc.handleAnswer(ar.InfoHash, ar.OfferID, *ar.Answer, *ar.PeerID)
 		}
 	}
 }
 
-func (tc *TrackerClient) handleOffer(
-	offer webrtc.SessionDescription,
-	offerId, peerId string) error {
-	peerConnection, answer, err := newAnsweringPeerConnection(offer)
+func (tc *TrackerClient) handleOffer(infoHash utils.InfoHash, signedOffer SessionDescription, offerId string, peerId utils.PeerID) {
+	tc.emit(event.Event{Type: event.OfferReceived, PeerID: peerId, InfoHash: infoHash, OfferID: offerId})
+	if err := tc.answerOffer(infoHash, signedOffer, offerId, peerId); err != nil {
+		tc.Logger.Error("error handling offer", log.KeyTracker, tc.Url, log.KeyPeerID, peerId.String(), log.KeyOfferID, log.OfferID(offerId), log.KeyError, err)
+		tc.emit(event.Event{Type: event.SignalingFailed, PeerID: peerId, InfoHash: infoHash, OfferID: offerId, Err: err})
+	}
+}
+
+func (tc *TrackerClient) answerOffer(
+	infoHash utils.InfoHash, signedOffer SessionDescription,
+	offerId string, peerId utils.PeerID) (err error) {
+	ctx, span := tc.startSignalingSpan("webtorrent.answer", infoHash, offerId)
+	span.SetAttributes(peerIDAttr(peerId))
+	tr := &offerTrace{ctx: ctx, span: span}
+	defer func() {
+		if err != nil {
+			tr.end(err)
+		}
+	}()
+	if err := tc.verifySDP(signedOffer, infoHash, peerId, offerId); err != nil {
+		metrics.Add("inbound offers with bad signatures", 1)
+		return fmt.Errorf("verifying offer: %w", err)
+	}
+	offer, err := tc.checkSDP(signedOffer.SessionDescription, peerId)
+	if err != nil {
+		return fmt.Errorf("validating offer: %w", err)
+	}
+	peerConnection, answer, err := tc.transport().newAnsweringPeerConnection(ctx, offer)
 	if err != nil {
 		return fmt.Errorf("write AnnounceResponse: %w", err)
 	}
+	signedAnswer := tc.signSDP(answer, infoHash, offerId)
 	response := AnnounceResponse{
 		Action:   "announce",
-		InfoHash: tc.InfoHash,
-		PeerID:   tc.PeerId,
-		ToPeerID: peerId,
-		Answer:   &answer,
+		InfoHash: infoHash,
+		PeerID:   &tc.PeerId,
+		ToPeerID: &peerId,
+		Answer:   &signedAnswer,
 		OfferID:  offerId,
 	}
 	data, err := json.Marshal(response)
@@ -280,63 +623,253 @@ func (tc *TrackerClient) handleOffer(
 	}
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
-	if err := tc.writeMessage(data); err != nil {
+	_, sendSpan := startSpan(ctx, "tracker send")
+	err = tc.writeMessage(data)
+	endSpan(sendSpan, err)
+	if err != nil {
 		peerConnection.Close()
 		return fmt.Errorf("writing response: %w", err)
 	}
-	timer := time.AfterFunc(offerTimeOut, func() {
-		metrics.Add("answering peer connections timed out", 1)
-		peerConnection.Close()
-	})
+	tc.pending[peerConnection] = struct{}{}
+	in := &inboundOffer{
+		infoHash:       infoHash,
+		offerId:        offerId,
+		peerId:         peerId,
+		offer:          offer,
+		answer:         answer,
+		peerConnection: peerConnection,
+		trace:          tr,
+	}
+	tr.startOpen()
+	in.timeout = time.AfterFunc(offerTimeOut, func() { tc.answerTimedOut(in) })
+	var mainOpened int32
 	peerConnection.OnDataChannel(func(d *webrtc.DataChannel) {
-		setDataChannelOnOpen(d, peerConnection, func(dc datachannel.ReadWriteCloser) {
-			timer.Stop()
-			metrics.Add("answering peer connection conversions", 1)
-			tc.mu.Lock()
-			tc.stats.ConvertedInboundConns++
-			tc.mu.Unlock()
-			tc.OnConn(dc, DataChannelContext{
-				Local:          answer,
-				Remote:         offer,
-				OfferId:        offerId,
-				LocalOffered:   false,
-				PeerID:         peerId,
-				peerConnection: peerConnection,
-			})
+		// The first channel the offerer opens is the conn, the rest are for OnDataChannel.
+		if !atomic.CompareAndSwapInt32(&mainOpened, 0, 1) {
+			peerConnection.handleStream(d)
+			return
+		}
+		setDataChannelOnOpen(d, peerConnection, tc.Health, tc.onPeerClosed(peerId, infoHash, offerId, false), func(dc *monitoredDataChannel) {
+			tc.answerOpened(in, dc)
 		})
 	})
 	return nil
 }
 
-func (tc *TrackerClient) handleAnswer(offerId string, answer webrtc.SessionDescription, peerId string) {
+func (tc *TrackerClient) answerTimedOut(in *inboundOffer) {
+	metrics.Add("answering peer connections timed out", 1)
+	tc.mu.Lock()
+	delete(tc.pending, in.peerConnection)
+	tc.mu.Unlock()
+	in.peerConnection.Close()
+	in.trace.end(errAnswerTimedOut)
+	tc.emit(event.Event{Type: event.AnswerTimedOut, PeerID: in.peerId, InfoHash: in.infoHash, OfferID: in.offerId})
+}
+
+// answerOpened hands the data channel of an offer we answered to the swarm, unless the answer
+// timed out first.
+func (tc *TrackerClient) answerOpened(in *inboundOffer, dc *monitoredDataChannel) {
+	if !in.timeout.Stop() {
+		// answerTimedOut closed the peer connection and reported the offer.
+		dc.Close()
+		return
+	}
+	metrics.Add("answering peer connection conversions", 1)
+	tc.mu.Lock()
+	delete(tc.pending, in.peerConnection)
+	onConn, joined := tc.swarms[in.infoHash]
+	delivered := joined && dc.deliver()
+	if delivered {
+		tc.stats.ConvertedInboundConns++
+	}
+	tc.mu.Unlock()
+	if !delivered {
+		// Left the swarm, or the peer went away, while connecting.
+		dc.Close()
+		in.peerConnection.Close()
+		in.trace.end(errOfferWithdrawn)
+		return
+	}
+	in.trace.end(nil)
+	tc.emit(event.Event{Type: event.PeerConnected, PeerID: in.peerId, InfoHash: in.infoHash, OfferID: in.offerId})
+	onConn(dc, DataChannelContext{
+		Local:          in.answer,
+		Remote:         in.offer,
+		OfferId:        in.offerId,
+		LocalOffered:   false,
+		PeerID:         in.peerId,
+		InfoHash:       in.infoHash,
+		peerConnection: in.peerConnection,
+	})
+}
+
+func (tc *TrackerClient) handleAnswer(infoHash utils.InfoHash, offerId string, signedAnswer SessionDescription, peerId utils.PeerID) {
+	if err := tc.verifySDP(signedAnswer, infoHash, peerId, offerId); err != nil {
+		metrics.Add("outbound offers answered with bad signatures", 1)
+		tc.recordAnswerError(offerId, peerId, err)
+		tc.Logger.Error("rejecting answer", log.KeyTracker, tc.Url, log.KeyPeerID, peerId.String(), log.KeyOfferID, log.OfferID(offerId), log.KeyError, err)
+		tc.emit(event.Event{Type: event.SignalingFailed, PeerID: peerId, InfoHash: infoHash, OfferID: offerId, LocalOffered: true, Err: err})
+		return
+	}
+	answer, err := tc.checkSDP(signedAnswer.SessionDescription, peerId)
+	if err != nil {
+		tc.recordAnswerError(offerId, peerId, err)
+		tc.Logger.Error("rejecting answer", log.KeyTracker, tc.Url, log.KeyPeerID, peerId.String(), log.KeyOfferID, log.OfferID(offerId), log.KeyError, err)
+		tc.emit(event.Event{Type: event.SignalingFailed, PeerID: peerId, InfoHash: infoHash, OfferID: offerId, LocalOffered: true, Err: err})
+		return
+	}
 	tc.mu.Lock()
-	defer tc.mu.Unlock()
 	offer, ok := tc.outboundOffers[offerId]
-	if !ok {
-		tc.Logger.Error("could not find offer for id %+q", offerId)
+	if !ok || offer.infoHash != infoHash {
+		tc.mu.Unlock()
+		tc.Logger.Error("could not find offer", log.KeyTracker, tc.Url, log.KeyPeerID, peerId.String(), log.KeyOfferID, log.OfferID(offerId))
 		return
 	}
 	// tc.Logger.WithDefaultLevel(log.Debug).Printf("offer %q got answer %v", offerId, answer)
 	metrics.Add("outbound offers answered", 1)
-	err := offer.setAnswer(answer, func(dc datachannel.ReadWriteCloser) {
+	tc.stats.OffersAnswered++
+	offer.trace.span.AddEvent("answer received", trace.WithAttributes(peerIDAttr(peerId)))
+	offer.trace.span.SetAttributes(peerIDAttr(peerId))
+	tc.answerTimes = append(tc.answerTimes, time.Since(offer.sent))
+	if len(tc.answerTimes) > maxAnswerTimes {
+		tc.answerTimes = tc.answerTimes[1:]
+	}
+	err = offer.setAnswer(answer, tc.Health, tc.onPeerClosed(peerId, infoHash, offerId, true), func(dc *monitoredDataChannel) {
 		offer.timeout.Stop()
-		metrics.Add("outbound offers answered with datachannel", 1)
 		tc.mu.Lock()
-		tc.stats.ConvertedOutboundConns++
+		_, pending := tc.pending[offer.peerConnection]
+		delete(tc.pending, offer.peerConnection)
+		onConn, joined := tc.swarms[infoHash]
+		delivered := pending && joined && dc.deliver()
+		if delivered {
+			tc.stats.ConvertedOutboundConns++
+		}
 		tc.mu.Unlock()
-		tc.OnConn(dc, DataChannelContext{
+		if !pending {
+			// Timed out or closed while connecting.
+			dc.Close()
+			offer.trace.end(errOfferWithdrawn)
+			return
+		}
+		metrics.Add("outbound offers answered with datachannel", 1)
+		if !delivered {
+			// Left the swarm, or the peer went away, while connecting.
+			dc.Close()
+			offer.peerConnection.Close()
+			offer.trace.end(errOfferWithdrawn)
+			return
+		}
+		offer.trace.end(nil)
+		tc.emit(event.Event{Type: event.PeerConnected, PeerID: peerId, InfoHash: infoHash, OfferID: offerId, LocalOffered: true})
+		onConn(dc, DataChannelContext{
 			Local:          offer.originalOffer,
 			Remote:         answer,
 			OfferId:        offerId,
 			LocalOffered:   true,
 			PeerID:         peerId,
+			InfoHash:       infoHash,
 			peerConnection: offer.peerConnection,
 		})
 	})
+	if err == nil {
+		delete(tc.outboundOffers, offerId)
+		tc.pending[offer.peerConnection] = struct{}{}
+		offer.trace.startOpen()
+	} else {
+		offer.trace.span.RecordError(err)
+	}
+	tc.mu.Unlock()
+
+	tc.emit(event.Event{Type: event.AnswerReceived, PeerID: peerId, InfoHash: infoHash, OfferID: offerId, LocalOffered: true})
 	if err != nil {
-		tc.Logger.Error("error using outbound offer answer: %v", err)
-		return
+		tc.Logger.Error("error using outbound offer answer", log.KeyTracker, tc.Url, log.KeyPeerID, peerId.String(), log.KeyOfferID, log.OfferID(offerId), log.KeyError, err)
+		tc.emit(event.Event{Type: event.SignalingFailed, PeerID: peerId, InfoHash: infoHash, OfferID: offerId, LocalOffered: true, Err: err})
+	}
+}
+
+// recordAnswerError notes an unusable answer on the span of the offer it answers. The offer stays
+// open for other answers.
+func (tc *TrackerClient) recordAnswerError(offerId string, peerId utils.PeerID, err error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if offer, ok := tc.outboundOffers[offerId]; ok {
+		offer.trace.span.RecordError(err, trace.WithAttributes(peerIDAttr(peerId)))
 	}
+}
 
-	delete(tc.outboundOffers, offerId)
+func (tc *TrackerClient) transport() *Transport {
+	if tc.Transport != nil {
+		return tc.Transport
+	}
+	return defaultTransport
+}
+
+// checkSDP applies the SDPPolicy to an offer or answer from a peer, counting what it rejects.
+func (tc *TrackerClient) checkSDP(desc webrtc.SessionDescription, peerId utils.PeerID) (webrtc.SessionDescription, error) {
+	var policy SDPPolicy
+	if tc.SDPPolicy != nil {
+		policy = *tc.SDPPolicy
+	}
+	filtered, dropped, err := policy.apply(desc)
+	tc.mu.Lock()
+	tc.stats.DroppedCandidates += int64(dropped)
+	if err != nil {
+		if desc.Type == webrtc.SDPTypeOffer {
+			tc.stats.RejectedOffers++
+		} else {
+			tc.stats.RejectedAnswers++
+		}
+	}
+	tc.mu.Unlock()
+	if dropped != 0 {
+		metrics.Add("dropped candidates", int64(dropped))
+		tc.Logger.Debug("dropped candidates", "count", dropped, "sdp_type", desc.Type.String(), log.KeyTracker, tc.Url, log.KeyPeerID, peerId.String())
+	}
+	if err != nil {
+		metrics.Add("rejected session descriptions", 1)
+	}
+	return filtered, err
+}
+
+func (tc *TrackerClient) onPeerClosed(peerId utils.PeerID, infoHash utils.InfoHash, offerId string, localOffered bool) func(error) {
+	return func(err error) {
+		if err != nil {
+			tc.Logger.Debug("lost peer connection", log.KeyTracker, tc.Url, log.KeyPeerID, peerId.String(), log.KeyError, err)
+		}
+		tc.emit(event.Event{
+			Type:         event.PeerDisconnected,
+			PeerID:       peerId,
+			InfoHash:     infoHash,
+			OfferID:      offerId,
+			LocalOffered: localOffered,
+			Err:          err,
+		})
+	}
+}
+
+// emit reports e to OnEvent, filling in the tracker and time. Callers must not hold tc.mu, so that
+// handlers can call back into the client.
+func (tc *TrackerClient) emit(e event.Event) {
+	e.Tracker = tc.Url
+	e.Time = time.Now()
+	if failureEvents[e.Type] {
+		err := e.Err
+		if err == nil {
+			err = failureEventErrs[e.Type]
+		}
+		tc.mu.Lock()
+		if tc.stats.Failures == nil {
+			tc.stats.Failures = make(map[event.Type]int64)
+			tc.stats.FailureReasons = make(map[string]int64)
+		}
+		tc.stats.Failures[e.Type]++
+		tc.stats.FailureReasons[failureReason(err)]++
+		tc.stats.LastError = err
+		tc.stats.LastErrorTime = e.Time
+		tc.mu.Unlock()
+	}
+	if tc.OnEvent == nil {
+		return
+	}
+	tc.OnEvent(e)
 }
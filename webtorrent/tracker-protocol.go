@@ -1,34 +1,102 @@
 package webtorrent
 
 import (
+	"encoding/json"
+
 	"github.com/pion/webrtc/v3"
+
+	"github.com/DaniilSokolyuk/gop2pt/utils"
 )
 
 type AnnounceRequest struct {
-	Numwant    int     `json:"numwant"`
-	Uploaded   int64   `json:"uploaded"`
-	Downloaded int64   `json:"downloaded"`
-	Left       int64   `json:"left"`
-	Action     string  `json:"action"`
-	InfoHash   string  `json:"info_hash"`
-	PeerID     string  `json:"peer_id"`
-	Offers     []Offer `json:"offers"`
+	Numwant    int            `json:"numwant"`
+	Uploaded   int64          `json:"uploaded"`
+	Downloaded int64          `json:"downloaded"`
+	Left       int64          `json:"left"`
+	Action     string         `json:"action"`
+	InfoHash   utils.InfoHash `json:"info_hash"`
+	PeerID     utils.PeerID   `json:"peer_id"`
+	Offers     []Offer        `json:"offers"`
+	Event      string         `json:"event,omitempty"` // started, stopped or completed
+	// Addresses the offers to one peer, see TrackerClient.OfferTo. Other trackers ignore it.
+	ToPeerID *utils.PeerID `json:"to_peer_id,omitempty"`
 }
 
 type Offer struct {
-	OfferID string                    `json:"offer_id"`
-	Offer   webrtc.SessionDescription `json:"offer"`
+	OfferID string             `json:"offer_id"`
+	Offer   SessionDescription `json:"offer"`
+}
+
+// SessionDescription is an offer or answer as relayed by the tracker. Trackers forward the object
+// as is, so it can carry a signature that other clients ignore.
+type SessionDescription struct {
+	webrtc.SessionDescription
+	Signature *SDPSignature `json:"gop2pt_signature,omitempty"`
 }
 
+type SDPSignature struct {
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+// AnnounceResponse is a message from the tracker. PeerID and ToPeerID are nil when the message
+// doesn't carry them. A malformed peer_id from another peer only costs that message: it decodes
+// to a nil PeerID and an error for whoever handles the message, instead of failing the decoding.
 type AnnounceResponse struct {
-	InfoHash   string                     `json:"info_hash"`
-	Action     string                     `json:"action"`
-	Interval   *int                       `json:"interval,omitempty"`
-	Complete   *int                       `json:"complete,omitempty"`
-	Incomplete *int                       `json:"incomplete,omitempty"`
-	PeerID     string                     `json:"peer_id,omitempty"`
-	ToPeerID   string                     `json:"to_peer_id,omitempty"`
-	Answer     *webrtc.SessionDescription `json:"answer,omitempty"`
-	Offer      *webrtc.SessionDescription `json:"offer,omitempty"`
-	OfferID    string                     `json:"offer_id,omitempty"`
+	InfoHash   utils.InfoHash      `json:"info_hash"`
+	Action     string              `json:"action"`
+	Interval   *int                `json:"interval,omitempty"`
+	Complete   *int                `json:"complete,omitempty"`
+	Incomplete *int                `json:"incomplete,omitempty"`
+	PeerID     *utils.PeerID       `json:"-"`
+	ToPeerID   *utils.PeerID       `json:"-"`
+	Answer     *SessionDescription `json:"answer,omitempty"`
+	Offer      *SessionDescription `json:"offer,omitempty"`
+	OfferID    string              `json:"offer_id,omitempty"`
+
+	peerIDErr error
+}
+
+// announceResponse has the fields of AnnounceResponse without its methods.
+type announceResponse AnnounceResponse
+
+// announceResponseJSON is AnnounceResponse as it appears on the wire.
+type announceResponseJSON struct {
+	announceResponse
+	PeerID   string `json:"peer_id,omitempty"`
+	ToPeerID string `json:"to_peer_id,omitempty"`
+}
+
+func (ar AnnounceResponse) MarshalJSON() ([]byte, error) {
+	wire := announceResponseJSON{announceResponse: announceResponse(ar)}
+	if ar.PeerID != nil {
+		wire.PeerID = ar.PeerID.JsonString()
+	}
+	if ar.ToPeerID != nil {
+		wire.ToPeerID = ar.ToPeerID.JsonString()
+	}
+	return json.Marshal(wire)
+}
+
+func (ar *AnnounceResponse) UnmarshalJSON(data []byte) error {
+	var wire announceResponseJSON
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	*ar = AnnounceResponse(wire.announceResponse)
+	if wire.PeerID != "" {
+		peerID, err := utils.PeerIDFromJsonString(wire.PeerID)
+		if err != nil {
+			ar.peerIDErr = err
+		} else {
+			ar.PeerID = &peerID
+		}
+	}
+	if wire.ToPeerID != "" {
+		// Only the tracker acts on it, so a malformed one is as good as none.
+		if toPeerID, err := utils.PeerIDFromJsonString(wire.ToPeerID); err == nil {
+			ar.ToPeerID = &toPeerID
+		}
+	}
+	return nil
 }
@@ -0,0 +1,77 @@
+package webtorrent
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/DaniilSokolyuk/gop2pt/utils"
+)
+
+// A malformed peer ID from another peer must not stop the rest of the response from decoding.
+func TestAnnounceResponseKeepsMalformedPeerID(t *testing.T) {
+	infoHash := utils.MakeInfoHash("malformed peer id")
+	data := `{"action":"announce","info_hash":` + string(mustMarshal(t, infoHash)) + `,"peer_id":"short","offer_id":"x","answer":{"type":"answer","sdp":""}}`
+	var ar AnnounceResponse
+	if err := json.Unmarshal([]byte(data), &ar); err != nil {
+		t.Fatal(err)
+	}
+	if ar.InfoHash != infoHash || ar.Answer == nil {
+		t.Fatalf("unexpected response %+v", ar)
+	}
+	if ar.PeerID != nil || !errors.Is(ar.peerIDErr, utils.ErrInvalidID) {
+		t.Fatalf("malformed peer id decoded to %v, error %v", ar.PeerID, ar.peerIDErr)
+	}
+}
+
+func TestAnnounceResponseRoundTrip(t *testing.T) {
+	peerID, toPeerID := utils.PeerID{1, 0xff}, utils.PeerID{2, 0x80}
+	ar := AnnounceResponse{
+		Action:   "announce",
+		InfoHash: utils.MakeInfoHash("round trip"),
+		PeerID:   &peerID,
+		ToPeerID: &toPeerID,
+		OfferID:  "offer",
+	}
+	data, err := json.Marshal(ar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire map[string]interface{}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		t.Fatal(err)
+	}
+	if wire["peer_id"] != peerID.JsonString() || wire["to_peer_id"] != toPeerID.JsonString() {
+		t.Fatalf("peer ids not sent as strings: %s", data)
+	}
+	var got AnnounceResponse
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.PeerID == nil || *got.PeerID != peerID || got.ToPeerID == nil || *got.ToPeerID != toPeerID ||
+		got.InfoHash != ar.InfoHash || got.OfferID != ar.OfferID || got.peerIDErr != nil {
+		t.Fatalf("decoded %+v, want %+v", got, ar)
+	}
+
+	// An announce response carries no peer ids.
+	data, err = json.Marshal(AnnounceResponse{Action: "announce", InfoHash: ar.InfoHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = AnnounceResponse{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.PeerID != nil || got.ToPeerID != nil || got.peerIDErr != nil {
+		t.Fatalf("decoded %s to %+v", data, got)
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
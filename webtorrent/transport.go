@@ -1,10 +1,12 @@
 package webtorrent
 
 import (
+	"context"
 	"expvar"
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 
 	"github.com/DaniilSokolyuk/gop2pt/pproffd"
 	"github.com/pion/datachannel"
@@ -12,35 +14,113 @@ import (
 )
 
 var (
-	metrics = expvar.NewMap("webtorrent")
-	api     = func() *webrtc.API {
-		// Enable the detach API (since it's non-standard but more idiomatic).
-		s.DetachDataChannels()
-		return webrtc.NewAPI(webrtc.WithSettingEngine(s))
-	}()
-	config              = webrtc.Configuration{ICEServers: []webrtc.ICEServer{}}
+	metrics          = expvar.NewMap("webtorrent")
+	defaultTransport = NewTransport(
+		NewSettingEngine(),
+		webrtc.Configuration{ICEServers: []webrtc.ICEServer{}},
+		PrivacyOff,
+	)
 	newPeerConnectionMu sync.Mutex
+	openPeerConnections int64
 )
 
+// OpenPeerConnections returns the number of peer connections created by all Transports that
+// haven't been closed yet. Tests use it to detect leaks.
+func OpenPeerConnections() int64 {
+	return atomic.LoadInt64(&openPeerConnections)
+}
+
+// Transport creates the peer connections for TrackerClients. It can be shared between clients.
+type Transport struct {
+	api     *webrtc.API
+	config  webrtc.Configuration
+	privacy PrivacyMode
+}
+
+// NewTransport creates a Transport from a copy of s, such as one from NewSettingEngine, with
+// privacy applied to it and config.
+func NewTransport(s webrtc.SettingEngine, config webrtc.Configuration, privacy PrivacyMode) *Transport {
+	privacy.configure(&s, &config)
+	// Enable the detach API (since it's non-standard but more idiomatic).
+	s.DetachDataChannels()
+	return &Transport{
+		api:     webrtc.NewAPI(webrtc.WithSettingEngine(s)),
+		config:  config,
+		privacy: privacy,
+	}
+}
+
 type wrappedPeerConnection struct {
 	*webrtc.PeerConnection
 	closeMu sync.Mutex
+	closed  bool
 	pproffd.CloseWrapper
+
+	// pion keeps only the last state handler set, so ours fan out to all of these.
+	handlersMu sync.Mutex
+	onState    []func(webrtc.PeerConnectionState)
+	onICEState []func(webrtc.ICEConnectionState)
+
+	// Data channels the peer opened after the first one, see DataChannelContext.OnDataChannel.
+	streamsMu     sync.Mutex
+	onStream      func(datachannel.ReadWriteCloser)
+	queuedStreams []datachannel.ReadWriteCloser
+}
+
+// OnConnectionStateChange adds f to the handlers of peer connection state changes, rather than
+// replacing the previous one as pion does.
+func (me *wrappedPeerConnection) OnConnectionStateChange(f func(webrtc.PeerConnectionState)) {
+	me.handlersMu.Lock()
+	defer me.handlersMu.Unlock()
+	if me.onState == nil {
+		me.PeerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+			me.handlersMu.Lock()
+			handlers := append(([]func(webrtc.PeerConnectionState))(nil), me.onState...)
+			me.handlersMu.Unlock()
+			for _, h := range handlers {
+				h(state)
+			}
+		})
+	}
+	me.onState = append(me.onState, f)
+}
+
+// OnICEConnectionStateChange adds f to the handlers of ICE connection state changes, rather than
+// replacing the previous one as pion does.
+func (me *wrappedPeerConnection) OnICEConnectionStateChange(f func(webrtc.ICEConnectionState)) {
+	me.handlersMu.Lock()
+	defer me.handlersMu.Unlock()
+	if me.onICEState == nil {
+		me.PeerConnection.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+			me.handlersMu.Lock()
+			handlers := append(([]func(webrtc.ICEConnectionState))(nil), me.onICEState...)
+			me.handlersMu.Unlock()
+			for _, h := range handlers {
+				h(state)
+			}
+		})
+	}
+	me.onICEState = append(me.onICEState, f)
 }
 
 func (me *wrappedPeerConnection) Close() error {
 	me.closeMu.Lock()
 	defer me.closeMu.Unlock()
+	if !me.closed {
+		me.closed = true
+		atomic.AddInt64(&openPeerConnections, -1)
+	}
 	return me.CloseWrapper.Close()
 }
 
-func newPeerConnection() (*wrappedPeerConnection, error) {
+func (t *Transport) newPeerConnection() (*wrappedPeerConnection, error) {
 	newPeerConnectionMu.Lock()
 	defer newPeerConnectionMu.Unlock()
-	pc, err := api.NewPeerConnection(config)
+	pc, err := t.api.NewPeerConnection(t.config)
 	if err != nil {
 		return nil, err
 	}
+	atomic.AddInt64(&openPeerConnections, 1)
 	return &wrappedPeerConnection{
 		PeerConnection: pc,
 		CloseWrapper:   pproffd.NewCloseWrapper(pc),
@@ -48,58 +128,78 @@ func newPeerConnection() (*wrappedPeerConnection, error) {
 }
 
 // newOffer creates a transport and returns a WebRTC offer to be announced
-func newOffer() (
+func (t *Transport) newOffer(ctx context.Context) (
 	peerConnection *wrappedPeerConnection,
 	dataChannel *webrtc.DataChannel,
 	offer webrtc.SessionDescription,
 	err error,
 ) {
-	peerConnection, err = newPeerConnection()
+	_, span := startSpan(ctx, "create offer")
+	peerConnection, err = t.newPeerConnection()
 	if err != nil {
+		endSpan(span, err)
 		return
 	}
 	dataChannel, err = peerConnection.CreateDataChannel("webrtc-datachannel", nil)
 	if err != nil {
+		endSpan(span, err)
 		peerConnection.Close()
 		return
 	}
+	// Any channel the answerer opens comes after ours.
+	peerConnection.OnDataChannel(peerConnection.handleStream)
 	offer, err = peerConnection.CreateOffer(nil)
 	if err != nil {
+		endSpan(span, err)
 		peerConnection.Close()
 		return
 	}
 
 	gatherComplete := webrtc.GatheringCompletePromise(peerConnection.PeerConnection)
 	err = peerConnection.SetLocalDescription(offer)
+	endSpan(span, err)
 	if err != nil {
 		peerConnection.Close()
 		return
 	}
+	_, span = startSpan(ctx, "ice gathering")
 	<-gatherComplete
+	span.End()
 
-	offer = *peerConnection.LocalDescription()
+	offer, err = t.privacy.sanitize(*peerConnection.LocalDescription())
+	if err != nil {
+		peerConnection.Close()
+	}
 	return
 }
 
 func initAnsweringPeerConnection(
+	ctx context.Context,
 	peerConnection *wrappedPeerConnection,
 	offer webrtc.SessionDescription,
 ) (answer webrtc.SessionDescription, err error) {
+	_, span := startSpan(ctx, "set remote description")
 	err = peerConnection.SetRemoteDescription(offer)
+	endSpan(span, err)
 	if err != nil {
 		return
 	}
+	_, span = startSpan(ctx, "create answer")
 	answer, err = peerConnection.CreateAnswer(nil)
 	if err != nil {
+		endSpan(span, err)
 		return
 	}
 
 	gatherComplete := webrtc.GatheringCompletePromise(peerConnection.PeerConnection)
 	err = peerConnection.SetLocalDescription(answer)
+	endSpan(span, err)
 	if err != nil {
 		return
 	}
+	_, span = startSpan(ctx, "ice gathering")
 	<-gatherComplete
+	span.End()
 
 	answer = *peerConnection.LocalDescription()
 	return
@@ -107,24 +207,34 @@ func initAnsweringPeerConnection(
 
 // newAnsweringPeerConnection creates a transport from a WebRTC offer and and returns a WebRTC answer to be
 // announced.
-func newAnsweringPeerConnection(offer webrtc.SessionDescription) (
+func (t *Transport) newAnsweringPeerConnection(ctx context.Context, offer webrtc.SessionDescription) (
 	peerConn *wrappedPeerConnection, answer webrtc.SessionDescription, err error,
 ) {
-	peerConn, err = newPeerConnection()
+	peerConn, err = t.newPeerConnection()
 	if err != nil {
 		err = fmt.Errorf("failed to create new connection: %w", err)
 		return
 	}
-	answer, err = initAnsweringPeerConnection(peerConn, offer)
+	answer, err = initAnsweringPeerConnection(ctx, peerConn, offer)
+	if err == nil {
+		answer, err = t.privacy.sanitize(answer)
+	}
 	if err != nil {
 		peerConn.Close()
 	}
 	return
 }
 
-func (t *outboundOffer) setAnswer(answer webrtc.SessionDescription, onOpen func(datachannel.ReadWriteCloser)) error {
-	setDataChannelOnOpen(t.dataChannel, t.peerConnection, onOpen)
+func (t *outboundOffer) setAnswer(
+	answer webrtc.SessionDescription,
+	health HealthConfig,
+	onClose func(error),
+	onOpen func(*monitoredDataChannel),
+) error {
+	setDataChannelOnOpen(t.dataChannel, t.peerConnection, health, onClose, onOpen)
+	_, span := startSpan(t.trace.ctx, "set remote description")
 	err := t.peerConnection.SetRemoteDescription(answer)
+	endSpan(span, err)
 	return err
 }
 
@@ -141,10 +251,15 @@ func (me ioCloserFunc) Close() error {
 	return me()
 }
 
+// setDataChannelOnOpen detaches the data channel once it opens and hands it to onOpen, monitored
+// according to health. Once onOpen delivers the channel, onClose is called once with the reason it
+// went away, or nil if it was closed locally.
 func setDataChannelOnOpen(
 	dc *webrtc.DataChannel,
 	pc *wrappedPeerConnection,
-	onOpen func(closer datachannel.ReadWriteCloser),
+	health HealthConfig,
+	onClose func(error),
+	onOpen func(*monitoredDataChannel),
 ) {
 	dc.OnOpen(func() {
 		raw, err := dc.Detach()
@@ -152,7 +267,7 @@ func setDataChannelOnOpen(
 			// This shouldn't happen if the API is configured correctly, and we call from OnOpen.
 			panic(err)
 		}
-		onOpen(hookDataChannelCloser(raw, pc))
+		onOpen(monitorDataChannel(hookDataChannelCloser(raw, pc), pc, health, onClose))
 	})
 }
 